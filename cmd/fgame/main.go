@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"embed"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"fgame/internal/server"
 )
@@ -14,6 +19,17 @@ var addr = flag.String("addr", "localhost:8080", "http service address")
 var maxPlayers = flag.Int("maxPlayers", 10, "maximum number of players in room")
 var maxScore = flag.Int("maxScore", 10, "maximum score for player")
 var timeoutMultiplier = flag.Int("timeoutMultiplier", 1, "timeout multiplier for debugging")
+var resultsDuration = flag.Int("resultsDuration", 10, "default number of seconds round results are shown for")
+var wordList = flag.String("wordList", "", "file with words filtered from names, chat and answers, one per line")
+var bansFile = flag.String("bans", "bans.json", "file the ban list is kept in, changes to it are picked up while running")
+var reportsFile = flag.String("reports", "reports.json", "file player reports are kept in")
+var trustedProxies = flag.String("trustedProxies", "", "comma separated addresses and CIDR ranges of proxies whose forwarding headers are trusted")
+var allowedOrigins = flag.String("allowedOrigins", "", "comma separated origins allowed to connect besides the server itself, e.g. https://example.com,*.example.com")
+var powDifficulty = flag.Int("powDifficulty", 0, "leading zero bits of the proof of work needed to register, rising when registrations spike, 0 turns it off")
+var maxConnectionsPerIP = flag.Int("maxConnectionsPerIP", 0, "maximum open connections from one address, 0 is no limit")
+var maxPlayersPerIP = flag.Int("maxPlayersPerIP", 0, "maximum registered players from one address, 0 is no limit")
+var maxRoomsPerIP = flag.Int("maxRoomsPerIP", 0, "maximum rooms created from one address, 0 is no limit")
+var adminToken = flag.String("adminToken", os.Getenv("FGAME_ADMIN_TOKEN"), "bearer token for the admin API, the API is disabled when empty")
 
 //go:embed web
 var webFS embed.FS
@@ -23,15 +39,164 @@ func handleSPA(w http.ResponseWriter, r *http.Request) {
 	http.FileServer(http.FS(webFS)).ServeHTTP(w, r)
 }
 
+// schemaCommand writes the protocol JSON Schema and TypeScript definitions,
+// with -check it fails instead if the checked in files are stale
+func schemaCommand(args []string) {
+	schemaFlags := flag.NewFlagSet("schema", flag.ExitOnError)
+	jsonPath := schemaFlags.String("json", "protocol.schema.json", "JSON Schema output path")
+	tsPath := schemaFlags.String("ts", "frontend/src/protocol.ts", "TypeScript definitions output path")
+	check := schemaFlags.Bool("check", false, "fail if the output files are stale instead of writing them")
+	schemaFlags.Parse(args)
+
+	schema, err := server.JSONSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	outputs := map[string][]byte{
+		*jsonPath: schema,
+		*tsPath:   server.TypeScript(),
+	}
+	stale := false
+	for path, content := range outputs {
+		if !*check {
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+		current, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(current, content) {
+			log.Printf("%v is stale, run fgame schema to regenerate it", path)
+			stale = true
+		}
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
+
+// adminRequest calls the admin API of a running server, body is sent as a
+// POST request when it is not nil
+func adminRequest(serverURL, token, path string, body interface{}, result interface{}) error {
+	method := http.MethodGet
+	var data []byte
+	if body != nil {
+		method = http.MethodPost
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(serverURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// reportsCommand lists, dismisses and acts on player reports through the
+// admin API of a running server
+func reportsCommand(args []string) {
+	reportsFlags := flag.NewFlagSet("reports", flag.ExitOnError)
+	serverURL := reportsFlags.String("server", "http://localhost:8080", "address of the running server")
+	token := reportsFlags.String("token", os.Getenv("FGAME_ADMIN_TOKEN"), "admin API token")
+	status := reportsFlags.String("status", "open", "reports to list: open, dismissed, banned or all")
+	hours := reportsFlags.Int("hours", 0, "ban duration in hours, 0 bans for good")
+	reportsFlags.Usage = func() {
+		fmt.Fprintln(reportsFlags.Output(), "usage: fgame reports [flags] [list | dismiss <id> | ban <id>]")
+		reportsFlags.PrintDefaults()
+	}
+	reportsFlags.Parse(args)
+
+	var err error
+	switch command, id := reportsFlags.Arg(0), reportsFlags.Arg(1); {
+	case command == "" || command == "list":
+		if *status == "all" {
+			*status = ""
+		}
+		var reports []server.Report
+		err = adminRequest(*serverURL, *token, "/admin/reports?status="+*status, nil, &reports)
+		for _, report := range reports {
+			fmt.Printf("%v %v %-9v %v reported %v %v of %v in room %v round %v: %v\n    %q\n",
+				report.Id, report.Created.Format("2006-01-02 15:04"), report.Status, report.ReporterName,
+				report.Target, report.TargetId, report.PlayerName, report.Room, report.Round, report.Reason, report.Content)
+		}
+	case command == "dismiss" && id != "":
+		var report server.Report
+		err = adminRequest(*serverURL, *token, "/admin/reports/dismiss", server.ReportActionRequest{Id: id}, &report)
+		if err == nil {
+			fmt.Println("Dismissed report", report.Id)
+		}
+	case command == "ban" && id != "":
+		var ban server.Ban
+		err = adminRequest(*serverURL, *token, "/admin/reports/ban", server.ReportActionRequest{Id: id, Hours: *hours}, &ban)
+		if err == nil {
+			fmt.Println("Banned", ban.Name)
+		}
+	default:
+		reportsFlags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func main() {
 	flag.Parse()
 	log.SetFlags(0)
-	fmt.Printf("Initializing server on address %v with maxPlayers = %v, maxScore = %v, timeoutMultiplier = %v\n", *addr, *maxPlayers, *maxScore, *timeoutMultiplier)
-	server.InitServer(*maxPlayers, *maxScore, *timeoutMultiplier)
+	switch flag.Arg(0) {
+	case "schema":
+		schemaCommand(flag.Args()[1:])
+		return
+	case "reports":
+		reportsCommand(flag.Args()[1:])
+		return
+	}
+	if err := server.SetPowDifficulty(*powDifficulty); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Initializing server on address %v with maxPlayers = %v, maxScore = %v, timeoutMultiplier = %v, resultsDuration = %v\n", *addr, *maxPlayers, *maxScore, *timeoutMultiplier, *resultsDuration)
+	server.InitServer(*maxPlayers, *maxScore, *timeoutMultiplier, *resultsDuration)
+	server.AdminToken = *adminToken
+	proxies, err := server.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.TrustedProxies = proxies
+	server.AllowedOrigins = server.ParseAllowedOrigins(*allowedOrigins)
+	server.MaxConnectionsPerIP = *maxConnectionsPerIP
+	server.MaxPlayersPerIP = *maxPlayersPerIP
+	server.MaxRoomsPerIP = *maxRoomsPerIP
+	if err := server.LoadReports(*reportsFile); err != nil {
+		log.Fatal(err)
+	}
+	if err := server.LoadBans(*bansFile); err != nil {
+		log.Fatal(err)
+	}
+	if *wordList != "" {
+		filter, err := server.LoadWordList(*wordList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.Filter = filter
+	}
 	http.HandleFunc("/ws", server.WsHandler)
+	http.HandleFunc("/admin/", server.AdminHandler)
 	http.HandleFunc("/", handleSPA)
 	go server.Server.InitializeRoomGarbageCollector()
 	go server.Server.InitializeStatusBroadcaster()
+	go server.Server.InitializeBanReloader()
 	log.Default().Println("Starting server on", *addr)
 	log.Fatal(http.ListenAndServe(*addr, nil))
 }
@@ -0,0 +1,270 @@
+// Code generated by "fgame schema"; DO NOT EDIT.
+
+export const protocolVersion = 2;
+
+export interface AnswerPayload {
+  answer: string;
+}
+
+export interface AnswerResult {
+  id: string;
+  content: string;
+  author: string;
+  votes: number;
+  points: number;
+  voters?: string[] | null;
+  crowdFavourite?: boolean;
+}
+
+export interface AnswerView {
+  id: string;
+  content: string;
+  own: boolean;
+}
+
+export interface ChallengeMsg {
+  msgType: 'challenge';
+  challenge: string;
+  difficulty: number;
+}
+
+export interface ChatHistoryMsg {
+  msgType: 'chatHistory';
+  messages: ChatMsg[] | null;
+  hasMore: boolean;
+}
+
+export interface ChatHistoryPayload {
+  before: number;
+  limit: number;
+}
+
+export interface ChatMsg {
+  msgType: 'chat';
+  id: number;
+  timestamp: number;
+  author: string;
+  chatMessage: string;
+  system: boolean;
+  private: boolean;
+  recipient?: string;
+}
+
+export interface ChatPayload {
+  message: string;
+}
+
+export interface Envelope {
+  v: number;
+  type: string;
+  id?: string;
+  payload?: unknown;
+}
+
+export interface ErrorMsg {
+  msgType: 'error';
+  error: string;
+  errorCode: number;
+  errorName: string;
+}
+
+export interface GameAnswer {
+  id: string;
+  content: string;
+}
+
+export interface HelloPayload {
+  versions: number[] | null;
+  locale: string;
+}
+
+export interface JoinRoomPayload {
+  room: string;
+}
+
+export interface JwtMsg {
+  msgType: 'jwt';
+  data: string;
+}
+
+export interface KickPayload {
+  name: string;
+}
+
+export interface LoginPayload {
+  token: string;
+}
+
+export interface MutePayload {
+  name: string;
+  muted: boolean;
+}
+
+export interface PatchOp {
+  op: string;
+  path: string;
+  value: unknown;
+}
+
+export interface Player {
+  name: string;
+  score: number;
+  actionDone: boolean;
+}
+
+export interface ReactPayload {
+  answerId?: string;
+  messageId?: number;
+  emoji: string;
+}
+
+export interface RegisterPayload {
+  name: string;
+  nonce?: string;
+}
+
+export interface ReportPayload {
+  player?: string;
+  messageId?: number;
+  answerId?: string;
+  reason: string;
+}
+
+export interface ResyncMsg {
+  msgType: 'resync';
+  self: SelfMsg | null;
+  state: RoomStateMsg | null;
+  chat: ChatMsg[] | null;
+}
+
+export interface ResyncPayload {
+  revision: number;
+}
+
+export interface RoomSettings {
+  maxScore: number;
+  ballotType: string;
+  maxVotes: number;
+  revealVoters: boolean;
+  resultsDuration: number;
+  hideProgress: boolean;
+  slowMode: number;
+  noCollusion: boolean;
+  crowdFavourite: number;
+  contentFilter: string;
+}
+
+export interface RoomStateDeltaMsg {
+  msgType: 'roomStateDelta';
+  revision: number;
+  baseRevision: number;
+  ops: PatchOp[] | null;
+}
+
+export interface RoomStateMsg {
+  msgType: 'roomState';
+  revision: number;
+  roomName: string;
+  isHost: boolean;
+  canVote: boolean;
+  players: Player[] | null;
+  answers: AnswerView[] | null;
+  gameStage: number;
+  question: string;
+  winner: Player | null;
+  winnerAnswer: GameAnswer | null;
+  results: AnswerResult[] | null;
+  settings: RoomSettings;
+  answerReactions: Record<string, Record<string, number>>;
+  chatReactions: Record<string, Record<string, number>>;
+  deadline: number;
+  serverTime: number;
+}
+
+export interface SelfMsg {
+  msgType: 'self';
+  name: string;
+  room: string;
+  actionDone: boolean;
+  answerId: string;
+  votedAnswerIds: string[] | null;
+}
+
+export interface SettingsPayload {
+  settings: RoomSettings;
+}
+
+export interface SlowModePayload {
+  seconds: number;
+}
+
+export interface StatusMsg {
+  msgType: 'status';
+  playerCount: number;
+  roomCount: number;
+}
+
+export interface TimeSyncMsg {
+  msgType: 'timeSync';
+  clientTime: number;
+  serverTime: number;
+}
+
+export interface TimeSyncPayload {
+  clientTime: number;
+}
+
+export interface VotePayload {
+  answerIds: string[] | null;
+}
+
+export interface WelcomeMsg {
+  msgType: 'welcome';
+  version: number;
+  supported: number[] | null;
+}
+
+export interface WhisperPayload {
+  to: string;
+  message: string;
+}
+
+export type ServerMessage =
+  | ChallengeMsg
+  | ChatMsg
+  | ChatHistoryMsg
+  | ErrorMsg
+  | JwtMsg
+  | ResyncMsg
+  | RoomStateMsg
+  | RoomStateDeltaMsg
+  | SelfMsg
+  | StatusMsg
+  | TimeSyncMsg
+  | WelcomeMsg;
+
+export interface ActionPayloads {
+  challenge: Record<string, never>;
+  changeSettings: SettingsPayload;
+  createRoom: Record<string, never>;
+  fetchChatHistory: ChatHistoryPayload;
+  hello: HelloPayload;
+  joinRoom: JoinRoomPayload;
+  kickPlayer: KickPayload;
+  leaveRoom: Record<string, never>;
+  login: LoginPayload;
+  mutePlayer: MutePayload;
+  nextRound: Record<string, never>;
+  react: ReactPayload;
+  ready: Record<string, never>;
+  register: RegisterPayload;
+  report: ReportPayload;
+  resyncState: ResyncPayload;
+  sendAnswer: AnswerPayload;
+  sendMessage: ChatPayload;
+  setSlowMode: SlowModePayload;
+  startGame: Record<string, never>;
+  timeSync: TimeSyncPayload;
+  voteAnswer: VotePayload;
+  whisper: WhisperPayload;
+}
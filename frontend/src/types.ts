@@ -4,10 +4,7 @@ export interface RoomMember {
   actionDone: boolean;
 }
 
-export interface Answer {
-  id: string;
-  content: string;
-}
+export type { GameAnswer as Answer } from './protocol';
 
 export enum GameStage {
   WaitingStage = 0,
@@ -7,4 +7,5 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gorilla/websocket v1.4.2
 	github.com/sethvargo/go-limiter v0.7.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 )
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminToken enables the admin API, requests must send it as a bearer token
+var AdminToken string
+
+// adminRoutes are served under /admin/ by AdminHandler
+var adminRoutes = map[string]http.HandlerFunc{
+	"/admin/shadowMute":      adminShadowMute,
+	"/admin/reports":         adminReports,
+	"/admin/reports/dismiss": adminDismissReport,
+	"/admin/reports/ban":     adminBanReport,
+	"/admin/bans":            adminBans,
+	"/admin/bans/remove":     adminRemoveBan,
+	"/admin/bans/reload":     adminReloadBans,
+	"/admin/metrics":         adminMetrics,
+}
+
+// AdminHandler serves the admin API, it is disabled when no AdminToken is set
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	route, ok := adminRoutes[r.URL.Path]
+	if AdminToken == "" || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+		activityLog("admin", 1, "rejected admin request from", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	route(w, r)
+}
+
+// readJSON decodes the body of a POST request, it replies with an error
+// and returns false when the request is not one
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		activityLog("admin", 0, err)
+	}
+}
+
+// ShadowMuteRequest is the body of POST /admin/shadowMute, Player is an id or a name
+type ShadowMuteRequest struct {
+	Player string `json:"player"`
+	Muted  bool   `json:"muted"`
+}
+
+// adminShadowMute lists shadow muted players on GET and changes them on POST
+func adminShadowMute(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, Server.shadowMutedPlayers())
+	case http.MethodPost:
+		var req ShadowMuteRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if err := Server.shadowMute(req.Player, req.Muted); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, Server.shadowMutedPlayers())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adminReports lists reports, ?status= picks open, dismissed or banned ones
+func adminReports(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, reports.list(ReportStatus(r.URL.Query().Get("status"))))
+}
+
+// ReportActionRequest is the body of POST /admin/reports/dismiss and
+// /admin/reports/ban, Hours is the ban duration with 0 banning for good
+type ReportActionRequest struct {
+	Id     string `json:"id"`
+	Hours  int    `json:"hours,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func adminDismissReport(w http.ResponseWriter, r *http.Request) {
+	var req ReportActionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	report, err := reports.get(req.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := reports.resolve(report, ReportDismissed, false); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// adminBanReport bans the reported player and closes every open report against them
+func adminBanReport(w http.ResponseWriter, r *http.Request) {
+	var req ReportActionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	report, err := reports.get(req.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = report.Reason
+	}
+	ban, err := Server.banPlayer(report.PlayerId, report.PlayerName, req.Reason, time.Duration(req.Hours)*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := reports.resolve(report, ReportBanned, true); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ban)
+}
+
+// BanRequest is the body of POST /admin/bans, Hours is the ban duration
+// with 0 banning for good
+type BanRequest struct {
+	IP       string `json:"ip,omitempty"`
+	PlayerId string `json:"playerId,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Reason   string `json:"reason"`
+	Hours    int    `json:"hours,omitempty"`
+}
+
+// adminBans lists active bans on GET and adds one on POST
+func adminBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, bans.list())
+		return
+	}
+	var req BanRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	ban := &Ban{IP: req.IP, PlayerId: req.PlayerId, Name: req.Name, Reason: req.Reason}
+	if req.Hours > 0 {
+		expires := time.Now().Add(time.Duration(req.Hours) * time.Hour)
+		ban.Expires = &expires
+	}
+	if err := bans.add(ban); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	activityLog("admin", 1, "Added ban", ban.Id, "for", ban.Reason)
+	Server.enforceBans()
+	writeJSON(w, ban)
+}
+
+func adminMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, Server.metricsSnapshot())
+}
+
+// IdRequest is the body of admin requests naming one item by id
+type IdRequest struct {
+	Id string `json:"id"`
+}
+
+func adminRemoveBan(w http.ResponseWriter, r *http.Request) {
+	var req IdRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := bans.remove(req.Id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, bans.list())
+}
+
+// adminReloadBans reads the ban file again right away
+func adminReloadBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bans.mu.Lock()
+	err := bans.reload()
+	bans.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Server.enforceBans()
+	writeJSON(w, bans.list())
+}
@@ -0,0 +1,61 @@
+package server
+
+import "fmt"
+
+type BallotType string
+
+const (
+	SingleBallot   BallotType = "single"
+	ApprovalBallot BallotType = "approval"
+	RankedBallot   BallotType = "ranked"
+)
+
+// Ballot defines how many answers a player may pick during the voting stage
+// and how many points each pick is worth
+type Ballot interface {
+	// maxChoices returns how many answers a player may pick out of eligible ones
+	maxChoices(eligible int) int
+	// points returns the score of the pick at position rank
+	points(rank int, eligible int) int
+}
+
+// singleBallot is one vote per player, worth one point
+type singleBallot struct{}
+
+func (singleBallot) maxChoices(eligible int) int       { return 1 }
+func (singleBallot) points(rank int, eligible int) int { return 1 }
+
+// approvalBallot allows up to limit votes per player, each worth one point
+type approvalBallot struct {
+	limit int
+}
+
+func (b approvalBallot) maxChoices(eligible int) int {
+	if b.limit < eligible {
+		return b.limit
+	}
+	return eligible
+}
+func (approvalBallot) points(rank int, eligible int) int { return 1 }
+
+// rankedBallot orders answers by preference and scores them with a Borda count,
+// the top pick is worth as many points as there are eligible answers
+type rankedBallot struct{}
+
+func (rankedBallot) maxChoices(eligible int) int       { return eligible }
+func (rankedBallot) points(rank int, eligible int) int { return eligible - rank }
+
+func newBallot(ballotType BallotType, maxVotes int) (Ballot, error) {
+	switch ballotType {
+	case SingleBallot:
+		return singleBallot{}, nil
+	case ApprovalBallot:
+		if maxVotes < 1 {
+			return nil, fmt.Errorf("approval ballot needs at least one vote, got %v", maxVotes)
+		}
+		return approvalBallot{limit: maxVotes}, nil
+	case RankedBallot:
+		return rankedBallot{}, nil
+	}
+	return nil, fmt.Errorf("unknown ballot type %v", ballotType)
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+// Ban keeps matching clients off the server until it expires, a
+// nil Expires never does. A ban matches when any of its non-empty fields does:
+// IP is an address or a CIDR range, Name is a case insensitive pattern
+// with * and ? wildcards matching any runes, a backslash escapes them
+type Ban struct {
+	Id       string     `json:"id"`
+	IP       string     `json:"ip,omitempty"`
+	PlayerId string     `json:"playerId,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Reason   string     `json:"reason"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+
+	network *net.IPNet
+	name    *regexp.Regexp
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return b.Expires != nil && now.After(*b.Expires)
+}
+
+// compile parses IP and checks Name, it must be called before matches
+func (b *Ban) compile() error {
+	if b.IP == "" && b.PlayerId == "" && b.Name == "" {
+		return fmt.Errorf("ban %v matches nobody", b.Id)
+	}
+	b.name = nil
+	if b.Name != "" {
+		name, err := compileNamePattern(b.Name)
+		if err != nil {
+			return fmt.Errorf("ban %v name pattern: %v", b.Id, err)
+		}
+		b.name = name
+	}
+	b.network = nil
+	if b.IP == "" {
+		return nil
+	}
+	if !strings.Contains(b.IP, "/") {
+		ip := net.ParseIP(b.IP)
+		if ip == nil {
+			return fmt.Errorf("ban %v has invalid ip %q", b.Id, b.IP)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		b.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return nil
+	}
+	_, network, err := net.ParseCIDR(b.IP)
+	if err != nil {
+		return fmt.Errorf("ban %v: %v", b.Id, err)
+	}
+	b.network = network
+	return nil
+}
+
+func (b *Ban) matches(ip net.IP, playerId string, name string) bool {
+	if b.network != nil && ip != nil && b.network.Contains(ip) {
+		return true
+	}
+	if b.PlayerId != "" && b.PlayerId == playerId {
+		return true
+	}
+	return b.name != nil && name != "" && b.name.MatchString(name)
+}
+
+// compileNamePattern turns a name pattern into a case insensitive regexp,
+// unlike path.Match the wildcards also match "/"
+func compileNamePattern(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			expr.WriteString(".*")
+		case r == '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("pattern %q ends with a backslash", pattern)
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// banList keeps bans in memory and saves them to a json file when it has a path
+type banList struct {
+	path     string
+	modified time.Time
+	bans     []*Ban
+	mu       sync.Mutex
+}
+
+var bans = &banList{}
+
+// LoadBans makes bans persistent in the file, bans already in it are loaded
+func LoadBans(path string) error {
+	bans.mu.Lock()
+	defer bans.mu.Unlock()
+	bans.path = path
+	return bans.reload()
+}
+
+// reload reads the bans from the file, a missing file is an empty list
+func (l *banList) reload() error {
+	if l.path == "" {
+		return nil
+	}
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		l.bans = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	var loaded []*Ban
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	for _, ban := range loaded {
+		if err := ban.compile(); err != nil {
+			return err
+		}
+	}
+	l.bans = loaded
+	l.modified = info.ModTime()
+	activityLog("admin", 2, "Loaded", len(loaded), "bans from", l.path)
+	return nil
+}
+
+// save drops expired bans and writes the rest, the file is replaced at once
+func (l *banList) save() error {
+	now := time.Now()
+	active := make([]*Ban, 0, len(l.bans))
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			active = append(active, ban)
+		}
+	}
+	l.bans = active
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.bans, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(l.path, data, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(l.path); err == nil {
+		l.modified = info.ModTime()
+	}
+	return nil
+}
+
+func (l *banList) add(ban *Ban) error {
+	ban.Id = uniuri.NewLen(8)
+	ban.Created = time.Now()
+	if err := ban.compile(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bans = append(l.bans, ban)
+	return l.save()
+}
+
+func (l *banList) remove(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, ban := range l.bans {
+		if ban.Id == id {
+			l.bans = append(l.bans[:i], l.bans[i+1:]...)
+			return l.save()
+		}
+	}
+	return fmt.Errorf("no ban with id %v", id)
+}
+
+func (l *banList) list() []*Ban {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	list := make([]*Ban, 0, len(l.bans))
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			list = append(list, ban)
+		}
+	}
+	return list
+}
+
+// check returns the ban matching the address, player id or name,
+// empty arguments match nothing
+func (l *banList) check(addr string, playerId string, name string) *Ban {
+	ip := net.ParseIP(addr)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for _, ban := range l.bans {
+		if !ban.expired(now) && ban.matches(ip, playerId, name) {
+			return ban
+		}
+	}
+	return nil
+}
+
+// InitializeBanReloader reloads the ban file when it is changed by hand
+func (gs *GameServer) InitializeBanReloader() {
+	intervalTicker := time.NewTicker(10 * time.Second)
+	for {
+		<-intervalTicker.C
+		bans.mu.Lock()
+		var err error
+		if info, statErr := os.Stat(bans.path); statErr == nil && info.ModTime().After(bans.modified) {
+			err = bans.reload()
+		}
+		bans.mu.Unlock()
+		if err != nil {
+			activityLog("admin", 0, "reloading bans:", err)
+			continue
+		}
+		gs.enforceBans()
+	}
+}
+
+// enforceBans drops players matching a ban from their room and the server
+func (gs *GameServer) enforceBans() {
+	gs.mu.Lock()
+	var banned []*Player
+	for c, player := range gs.players {
+		if bans.check(c.addr, player.id, player.Name) != nil {
+			banned = append(banned, player)
+		}
+	}
+	gs.mu.Unlock()
+	for _, player := range banned {
+		activityLog("admin", 1, "Disconnecting banned player", player.Name)
+		player.disconnect(ErrBanned)
+	}
+}
+
+// nameMeta are the runes with a meaning in name patterns
+var nameMeta = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`)
+
+// banPlayer bans the player id and name and, while they are connected, their address
+func (gs *GameServer) banPlayer(playerId string, name string, reason string, duration time.Duration) (*Ban, error) {
+	ban := &Ban{PlayerId: playerId, Name: nameMeta.Replace(name), Reason: reason}
+	if player, err := gs.findPlayer(playerId); err == nil {
+		player.mu.Lock()
+		ban.IP = player.addr()
+		player.mu.Unlock()
+		if net.ParseIP(ban.IP) == nil {
+			ban.IP = ""
+		}
+	}
+	if duration > 0 {
+		expires := time.Now().Add(duration)
+		ban.Expires = &expires
+	}
+	if err := bans.add(ban); err != nil {
+		return nil, err
+	}
+	activityLog("admin", 1, "Player", name, "banned:", reason)
+	gs.enforceBans()
+	return ban, nil
+}
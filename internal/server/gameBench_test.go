@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchPlayers is the number of players in the benchmarked room
+const benchPlayers = 10
+
+// benchRoomState is the state of a room with the given number of players at
+// the end of a round
+func benchRoomState(players int) *RoomStateMsg {
+	state := &RoomStateMsg{
+		MsgType:   "roomState",
+		RoomName:  "ABCDEFGH",
+		GameStage: WinnerStage,
+		Question:  "What is the best way to spend _____?",
+		Settings:  defaultRoomSettings(),
+	}
+	for i := 0; i < players; i++ {
+		player := &Player{Name: fmt.Sprintf("Player %v", i), Score: i % 4, ActionDone: i%2 == 0}
+		answer := &AnswerView{Id: fmt.Sprintf("%016d", i), Content: strings.Repeat("answer ", 5)}
+		state.Players = append(state.Players, player)
+		state.Answers = append(state.Answers, answer)
+		state.Results = append(state.Results, &AnswerResult{
+			Id:      answer.Id,
+			Content: answer.Content,
+			Author:  player.Name,
+			Votes:   i % 3,
+			Points:  i % 3,
+		})
+	}
+	state.Winner = state.Players[0]
+	state.WinnerAnswer = &GameAnswer{Id: state.Answers[0].Id, Content: state.Answers[0].Content}
+	return state
+}
+
+// BenchmarkPayloads encodes room messages in every wire format and reports
+// their encoded size
+func BenchmarkPayloads(b *testing.B) {
+	messages := []struct {
+		name string
+		msg  serverMessage
+	}{
+		{"roomState", benchRoomState(benchPlayers)},
+		{"chat", newChatMsg("Player 0", "hello everyone")},
+	}
+	formats := []struct {
+		name  string
+		codec codec
+	}{
+		{jsonSubprotocol, jsonCodec{}},
+		{msgpackSubprotocol, msgpackCodec{}},
+	}
+	for _, message := range messages {
+		for _, format := range formats {
+			msg, codec := message.msg, format.codec
+			b.Run(message.name+"/"+format.name, func(b *testing.B) {
+				data, err := codec.marshal(msg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					codec.marshal(msg)
+				}
+				b.ReportMetric(float64(len(data)), "bytes")
+			})
+		}
+	}
+}
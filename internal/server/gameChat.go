@@ -0,0 +1,164 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// chatHistorySize is how many chat messages a room keeps
+	chatHistorySize = 200
+	// chatReplaySize is how many chat messages are sent to joining and reconnecting players
+	chatReplaySize = 50
+	// maxSlowMode is the longest slow mode delay in seconds
+	maxSlowMode = 600
+)
+
+// checkChat reports whether the player may send the message now and
+// records the time of the message for slow mode, the host is not slowed down
+func (s *GameRoom) checkChat(pl *Player, message string) error {
+	if len(message) == 0 {
+		return ErrEmptyMessage
+	}
+	if utf8.RuneCountInString(message) > maxMessageLength {
+		return ErrMessageTooLong
+	}
+	if s.isMuted(pl) {
+		return ErrMuted
+	}
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	slowMode := time.Duration(s.Settings.SlowMode) * time.Second
+	if slowMode > 0 && s.getHost() != pl && time.Since(pl.lastMessage) < slowMode {
+		return ErrSlowMode
+	}
+	pl.lastMessage = time.Now()
+	return nil
+}
+
+// whisper sends a message only to the author and the recipient, given by
+// name, whispers are not kept in the room history
+func (s *GameRoom) whisper(pl *Player, to string, message string) error {
+	if s.Settings.NoCollusion && (s.GameStage == WritingStage || s.GameStage == VotingStage) {
+		return ErrWhisperDisabled
+	}
+	recipient, err := s.getPlayerByName(to)
+	if err != nil {
+		return err
+	}
+	if recipient == pl {
+		return ErrWhisperSelf
+	}
+	if err := s.checkChat(pl, message); err != nil {
+		return err
+	}
+	message, err = s.filterText(message)
+	if err != nil {
+		return err
+	}
+	msg := newEchoMsg(pl.Name, message)
+	msg.Recipient = recipient.Name
+	pl.connection.send(msg)
+	if !Server.isShadowMuted(pl) {
+		recipient.connection.send(msg)
+	}
+	return nil
+}
+
+// setSlowMode changes the delay between chat messages at any stage of the game
+func (s *GameRoom) setSlowMode(seconds int) error {
+	if seconds < 0 || seconds > maxSlowMode {
+		return ErrInvalidSlowMode
+	}
+	s.Settings.SlowMode = seconds
+	if seconds == 0 {
+		s.sendSystemMessage("Slow mode is off")
+	} else {
+		s.sendSystemMessage(fmt.Sprintf("Slow mode is on, one message every %v seconds", seconds))
+	}
+	s.sendState()
+	return nil
+}
+
+// chatHistory is a ring buffer of the latest chat messages of a room
+type chatHistory struct {
+	messages []*ChatMsg
+	next     int // index the next message is written to
+	count    int
+	lastId   int64
+	mu       sync.Mutex
+}
+
+func newChatHistory(size int) *chatHistory {
+	return &chatHistory{messages: make([]*ChatMsg, size)}
+}
+
+// add assigns msg an id and a timestamp and stores it, overwriting the
+// oldest message, the id of the overwritten message is returned
+func (h *chatHistory) add(msg *ChatMsg) (evicted int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if old := h.messages[h.next]; old != nil {
+		evicted = old.Id
+	}
+	h.lastId++
+	msg.Id = h.lastId
+	msg.Timestamp = unixMilli(time.Now())
+	h.messages[h.next] = msg
+	h.next = (h.next + 1) % len(h.messages)
+	if h.count < len(h.messages) {
+		h.count++
+	}
+	return evicted
+}
+
+// reserveId uses up the next message id without storing a message, for
+// messages that look like room chat but are shown to their author only,
+// stored ids are therefore not contiguous
+func (h *chatHistory) reserveId() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastId++
+	return h.lastId
+}
+
+// get returns the message with the id if it is still kept
+func (h *chatHistory) get(id int64) *ChatMsg {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, msg := range h.messages {
+		if msg != nil && msg.Id == id {
+			return msg
+		}
+	}
+	return nil
+}
+
+// before returns up to limit messages older than the message with id before,
+// oldest first, and whether even older messages are kept
+func (h *chatHistory) before(before int64, limit int) ([]*ChatMsg, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	older := []*ChatMsg{}
+	oldest := h.next - h.count + len(h.messages)
+	for i := 0; i < h.count; i++ {
+		msg := h.messages[(oldest+i)%len(h.messages)]
+		if msg.Id < before {
+			older = append(older, msg)
+		}
+	}
+	if len(older) <= limit {
+		return older, false
+	}
+	return older[len(older)-limit:], true
+}
+
+// latest returns up to limit newest messages, oldest first
+func (h *chatHistory) latest(limit int) ([]*ChatMsg, bool) {
+	h.mu.Lock()
+	before := h.lastId + 1
+	h.mu.Unlock()
+	return h.before(before, limit)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client is a websocket connection together with the protocol it speaks
+type Client struct {
+	conn    *websocket.Conn
+	codec   codec
+	version int
+	locale  string
+	// addr is the resolved client address used for rate limiting, bans and logs
+	addr string
+	// challenge has to be solved before registering when proof of work is on
+	challenge *powChallenge
+
+	// request currently being handled, set for versioned actions only
+	requestId     string
+	requestFailed bool
+	mu            sync.Mutex
+}
+
+func NewClient(c *websocket.Conn) *Client {
+	return &Client{conn: c, codec: codecFor(c.Subprotocol()), version: legacyProtocol}
+}
+
+// send sends msg in the format of the client protocol, errors
+// are tagged with the id of the request being handled
+func (cl *Client) send(msg serverMessage) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.version == legacyProtocol {
+		return cl.write(msg)
+	}
+	// payload keeps msgType so clients can reuse legacy message handlers
+	envelope := &Envelope{V: cl.version, Type: msg.messageType(), Payload: msg}
+	if _, ok := msg.(*ErrorMsg); ok {
+		envelope.Id = cl.requestId
+		cl.requestFailed = true
+	}
+	return cl.write(envelope)
+}
+
+// write encodes v with the client codec, callers must hold mu
+func (cl *Client) write(v interface{}) error {
+	data, err := cl.codec.marshal(v)
+	if err != nil {
+		return err
+	}
+	return cl.conn.WriteMessage(cl.codec.frameType(), data)
+}
+
+// sendError reports err to the client in the client locale
+func (cl *Client) sendError(err error) error {
+	return cl.send(newErrorMsg(err, cl.locale))
+}
+
+// beginRequest marks the start of handling action
+func (cl *Client) beginRequest(action Action) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.requestId = action.Id
+	cl.requestFailed = false
+}
+
+// endRequest acknowledges the handled action unless an error was sent for it
+func (cl *Client) endRequest() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.version != legacyProtocol && cl.requestId != "" && !cl.requestFailed {
+		cl.write(&Envelope{V: cl.version, Type: "ack", Id: cl.requestId})
+	}
+	cl.requestId = ""
+}
+
+// negotiate picks the newest protocol version supported by both sides
+func (cl *Client) negotiate(versions []int, locale string) bool {
+	best := 0
+	for _, version := range versions {
+		if version >= legacyProtocol && version <= latestProtocol && version > best {
+			best = version
+		}
+	}
+	if best == 0 {
+		return false
+	}
+	cl.mu.Lock()
+	cl.version = best
+	cl.locale = locale
+	cl.mu.Unlock()
+	cl.send(
+		&WelcomeMsg{
+			MsgType:   "welcome",
+			Version:   best,
+			Supported: []int{legacyProtocol, latestProtocol},
+		})
+	return true
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the networks whose forwarding headers are believed,
+// without any the peer address of the connection is the client address
+var TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma separated list of addresses and CIDR ranges
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHostIP parses an address with or without a port, IPv6 addresses
+// may be in brackets and carry a zone
+func parseHostIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if i := strings.IndexByte(addr, '%'); i >= 0 {
+		addr = addr[:i]
+	}
+	return net.ParseIP(addr)
+}
+
+// forwardedFor returns the client addresses listed by proxies, the client
+// first and the closest proxy last, from the standard Forwarded header or
+// else X-Forwarded-For or X-Real-IP
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, node := "", ""
+				if parts := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(parts) == 2 {
+					key, node = parts[0], parts[1]
+				}
+				if strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(node, `"`))
+				}
+			}
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	if realIP := header.Get("X-Real-IP"); realIP != "" {
+		return []string{realIP}
+	}
+	return nil
+}
+
+// clientIP resolves the address of the client, forwarding headers are only
+// followed through trusted proxies so clients can't spoof them
+func clientIP(r *http.Request) net.IP {
+	ip := parseHostIP(r.RemoteAddr)
+	if ip == nil || !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHostIP(hops[i])
+		if hop == nil {
+			// obfuscated or garbled, the last proxy is the best we know
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Websocket subprotocols selecting the wire format, clients that
+// don't ask for one get json
+const (
+	jsonSubprotocol    = "fgame.json"
+	msgpackSubprotocol = "fgame.msgpack"
+)
+
+// codec encodes messages in one wire format, every format uses the json field names
+type codec interface {
+	marshal(v interface{}) ([]byte, error)
+	// toJSON converts a received message to json for parseAction
+	toJSON(message []byte) ([]byte, error)
+	// frameType is the websocket message type frames are sent with
+	frameType() int
+}
+
+func codecFor(subprotocol string) codec {
+	if subprotocol == msgpackSubprotocol {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+func (jsonCodec) toJSON(message []byte) ([]byte, error) { return message, nil }
+func (jsonCodec) frameType() int                        { return websocket.TextMessage }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) toJSON(message []byte) ([]byte, error) {
+	var v interface{}
+	if err := msgpack.Unmarshal(message, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (msgpackCodec) frameType() int { return websocket.BinaryMessage }
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// chatCommand is run when a chat message starts with "/" and its name,
+// replies are sent only to the player who used the command
+type chatCommand struct {
+	usage string
+	help  string
+	run   func(pl *Player, args []string) error
+}
+
+var chatCommands map[string]*chatCommand
+
+// broadcastCommands post to the room chat, so mute, slow mode and the
+// length limit apply to them like to chat messages
+var broadcastCommands = map[string]bool{"roll": true}
+
+func init() {
+	chatCommands = map[string]*chatCommand{
+		"help": {"/help", "list commands", helpCommand},
+		"start": {"/start", "start the game", func(pl *Player, args []string) error {
+			return pl.room.startGame(pl)
+		}},
+		"skip": {"/skip", "end the current stage", func(pl *Player, args []string) error {
+			return pl.room.skipStage(pl)
+		}},
+		"settings": {"/settings <name> <value>", "change a room setting", settingsCommand},
+		"kick": {"/kick <player>", "remove a player from the room", func(pl *Player, args []string) error {
+			if len(args) == 0 {
+				return ErrInvalidCommand
+			}
+			return pl.room.kickPlayer(pl, strings.Join(args, " "))
+		}},
+		"mute": {"/mute <player>", "stop a player from chatting", func(pl *Player, args []string) error {
+			if len(args) == 0 {
+				return ErrInvalidCommand
+			}
+			return pl.room.mutePlayer(pl, strings.Join(args, " "), true)
+		}},
+		"unmute": {"/unmute <player>", "let a muted player chat again", func(pl *Player, args []string) error {
+			if len(args) == 0 {
+				return ErrInvalidCommand
+			}
+			return pl.room.mutePlayer(pl, strings.Join(args, " "), false)
+		}},
+		"w": {"/w <player> <message>", "send a message only the player sees", func(pl *Player, args []string) error {
+			recipient, message, err := pl.room.splitPlayerName(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			if message == "" {
+				return ErrInvalidCommand
+			}
+			return pl.room.whisper(pl, recipient.Name, message)
+		}},
+		"roll": {"/roll [sides]", "roll a dice, 6 sides by default", rollCommand},
+	}
+}
+
+// isCommand reports whether the chat message is a command, "//" escapes a
+// message that starts with a slash
+func isCommand(message string) bool {
+	return strings.HasPrefix(message, "/") && !strings.HasPrefix(message, "//")
+}
+
+// runCommand parses and runs a chat command, unknown commands and usage
+// errors are explained to the player privately instead of as an error
+func runCommand(pl *Player, message string) error {
+	fields := strings.Fields(strings.TrimPrefix(message, "/"))
+	var command *chatCommand
+	name := ""
+	if len(fields) > 0 {
+		name = strings.ToLower(fields[0])
+		command = chatCommands[name]
+	}
+	if command == nil {
+		pl.connection.send(newSystemMsg("Unknown command, type /help for the list of commands"))
+		return nil
+	}
+	if broadcastCommands[name] {
+		if err := pl.room.checkChat(pl, message); err != nil {
+			return err
+		}
+	}
+	activityLog("chat", 3, "Player", pl.Name, "used command", message)
+	err := command.run(pl, fields[1:])
+	if err == ErrInvalidCommand {
+		pl.connection.send(newSystemMsg("Usage: " + command.usage))
+		return nil
+	}
+	return err
+}
+
+func helpCommand(pl *Player, args []string) error {
+	lines := []string{"Commands:"}
+	for _, name := range sortedKeys(chatCommands) {
+		command := chatCommands[name]
+		lines = append(lines, fmt.Sprintf("%v - %v", command.usage, command.help))
+	}
+	pl.connection.send(newSystemMsg(strings.Join(lines, "\n")))
+	return nil
+}
+
+// settingsCommand changes one setting, values that are not json are taken as strings
+func settingsCommand(pl *Player, args []string) error {
+	if len(args) != 2 {
+		return ErrInvalidCommand
+	}
+	value := json.RawMessage(args[1])
+	if !json.Valid(value) {
+		value, _ = json.Marshal(args[1])
+	}
+	data, err := json.Marshal(map[string]json.RawMessage{args[0]: value})
+	if err != nil {
+		return ErrInvalidCommand
+	}
+	if err := pl.room.changeSettings(pl, data); err != nil {
+		return err
+	}
+	pl.connection.send(newSystemMsg(fmt.Sprintf("Setting %v changed to %s", args[0], value)))
+	return nil
+}
+
+func rollCommand(pl *Player, args []string) error {
+	sides := 6
+	if len(args) > 0 {
+		var err error
+		sides, err = strconv.Atoi(args[0])
+		if err != nil || sides < 2 || sides > 1000 {
+			return ErrInvalidCommand
+		}
+	}
+	pl.room.sendSystemMessage(fmt.Sprintf("%v rolled %v (1-%v)", pl.Name, rand.Intn(sides)+1, sides))
+	return nil
+}
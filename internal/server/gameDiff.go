@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is a JSON Patch (RFC 6902) style operation, Value is null for removals
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// toTree converts v into the generic representation produced by json.Unmarshal
+func toTree(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	err = json.Unmarshal(data, &tree)
+	return tree, err
+}
+
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// diffTree appends operations turning tree a into tree b to ops, objects are
+// compared key by key, arrays of the same length item by item, everything
+// else is replaced as a whole
+func diffTree(path string, a, b interface{}, ops []PatchOp) []PatchOp {
+	switch bValue := b.(type) {
+	case map[string]interface{}:
+		aValue, ok := a.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for key := range aValue {
+			if _, ok := bValue[key]; !ok {
+				ops = append(ops, PatchOp{Op: "remove", Path: path + "/" + escapePointer(key)})
+			}
+		}
+		for _, key := range sortedKeys(bValue) {
+			keyPath := path + "/" + escapePointer(key)
+			if old, ok := aValue[key]; ok {
+				ops = diffTree(keyPath, old, bValue[key], ops)
+			} else {
+				ops = append(ops, PatchOp{Op: "add", Path: keyPath, Value: bValue[key]})
+			}
+		}
+		return ops
+	case []interface{}:
+		aValue, ok := a.([]interface{})
+		if !ok || len(aValue) != len(bValue) {
+			break
+		}
+		for i := range bValue {
+			ops = diffTree(path+"/"+strconv.Itoa(i), aValue[i], bValue[i], ops)
+		}
+		return ops
+	}
+	if !reflect.DeepEqual(a, b) {
+		ops = append(ops, PatchOp{Op: "replace", Path: path, Value: b})
+	}
+	return ops
+}
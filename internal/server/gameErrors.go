@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GameError is an error reported to the client, Code and Name are stable
+// and can be relied on by clients, Message is the default english text
+type GameError struct {
+	Code    int
+	Name    string
+	Message string
+	// key selects the translation, it is Name unless several errors share a code
+	key string
+}
+
+func (e *GameError) Error() string {
+	return e.Message
+}
+
+// errorRegistry holds every GameError by code
+var errorRegistry = make(map[int]*GameError)
+
+func newGameError(code int, name string, message string) *GameError {
+	if _, ok := errorRegistry[code]; ok {
+		panic(fmt.Sprintf("error code %v registered twice", code))
+	}
+	e := &GameError{Code: code, Name: name, Message: message, key: name}
+	errorRegistry[code] = e
+	return e
+}
+
+// notHost returns a not_host error with its own message and translation key,
+// clients can rely on the code and name of ErrNotHost for all of them
+func notHost(key string, message string) *GameError {
+	return &GameError{Code: ErrNotHost.Code, Name: ErrNotHost.Name, Message: message, key: key}
+}
+
+// Error codes are grouped by tens: 0x protocol, 1x player, 2x room, 3x game, 4x content,
+// 5x reactions, 6x moderation
+var (
+	ErrInternal              = newGameError(0, "internal", "Internal server error")
+	ErrUnsupportedProtocol   = newGameError(1, "unsupported_protocol", "Unsupported protocol version")
+	ErrInvalidPayload        = newGameError(2, "invalid_payload", "Invalid payload")
+	ErrUnknownAction         = newGameError(3, "unknown_action", "Unknown action")
+	ErrProtocolNotNegotiated = newGameError(4, "protocol_not_negotiated", "Protocol version not negotiated")
+	ErrMalformedMessage      = newGameError(5, "malformed_message", "Malformed message")
+	ErrRateLimited           = newGameError(6, "rate_limited", "Too many requests, slow down")
+
+	ErrInvalidToken      = newGameError(10, "invalid_token", "Invalid jwt")
+	ErrNameTaken         = newGameError(11, "name_taken", "Name already taken")
+	ErrNotRegistered     = newGameError(12, "not_registered", "Player not registered")
+	ErrPlayerNotFound    = newGameError(13, "player_not_found", "Player not found")
+	ErrBanned            = newGameError(14, "banned", "You are banned from this server")
+	ErrChallengeRequired = newGameError(15, "challenge_required", "Solve the challenge before registering")
+	ErrInvalidProof      = newGameError(16, "invalid_proof", "Challenge solution is wrong")
+	ErrTooManyPlayers    = newGameError(17, "too_many_players", "Too many players from your address")
+
+	ErrRoomNotFound    = newGameError(20, "room_not_found", "Room not found")
+	ErrNotInRoom       = newGameError(21, "not_in_room", "Player not in room")
+	ErrAlreadyInRoom   = newGameError(22, "already_in_room", "Player already in a room")
+	ErrLeaveNotInRoom  = newGameError(23, "leave_not_in_room", "Player not in a room")
+	ErrNotHost         = newGameError(24, "not_host", "Only host is allowed to do that")
+	ErrRoomFull        = newGameError(25, "room_full", "Room is full")
+	ErrInvalidSettings = newGameError(26, "invalid_settings", "Invalid room settings")
+	ErrGameNotStarted  = newGameError(27, "game_not_started", "Game has not started")
+	ErrTooManyRooms    = newGameError(28, "too_many_rooms", "Too many rooms created from your address")
+	ErrKickSelf        = newGameError(29, "kick_self", "Can't kick yourself")
+
+	ErrGameInProgress  = newGameError(30, "game_in_progress", "Game in progress")
+	ErrNotWritingStage = newGameError(31, "not_writing_stage", "Not writing stage")
+	ErrNotVotingStage  = newGameError(32, "not_voting_stage", "Not voting stage")
+	ErrOwnAnswerVote   = newGameError(33, "own_answer_vote", "Can't vote for your own answer")
+	ErrAnswerNotFound  = newGameError(34, "answer_not_found", "Answer not found")
+	ErrAlreadyVoted    = newGameError(35, "already_voted", "Already voted")
+	ErrTooManyVotes    = newGameError(36, "too_many_votes", "Too many votes")
+	ErrDuplicateVote   = newGameError(37, "duplicate_vote", "Can't vote for the same answer twice")
+	ErrNotResultsStage = newGameError(38, "not_results_stage", "Not results stage")
+	ErrAlreadyAnswered = newGameError(39, "already_answered", "Already answered")
+
+	ErrEmptyMessage         = newGameError(40, "empty_message", "Message must not be empty")
+	ErrMessageTooLong       = newGameError(41, "message_too_long", "Message is too long")
+	ErrSlowMode             = newGameError(42, "slow_mode", "Slow mode is on, wait before sending another message")
+	ErrInvalidSlowMode      = newGameError(43, "invalid_slow_mode", fmt.Sprintf("Slow mode must be between 0 and %v seconds", maxSlowMode))
+	ErrUnknownCommand       = newGameError(44, "unknown_command", "Unknown command")
+	ErrInvalidCommand       = newGameError(45, "invalid_command", "Invalid command arguments")
+	ErrMuted                = newGameError(46, "muted", "You are muted in this room")
+	ErrWhisperDisabled      = newGameError(47, "whisper_disabled", "Whispers are disabled while players answer and vote")
+	ErrWhisperSelf          = newGameError(48, "whisper_self", "Can't whisper to yourself")
+	ErrInappropriateContent = newGameError(49, "inappropriate_content", "Text contains words that are not allowed")
+
+	ErrInvalidReaction   = newGameError(50, "invalid_reaction", "Invalid reaction")
+	ErrMessageNotFound   = newGameError(51, "message_not_found", "Message not found")
+	ErrReactionLimit     = newGameError(52, "reaction_limit", "Too many reactions")
+	ErrOwnAnswerReaction = newGameError(53, "own_answer_reaction", "Can't react to your own answer")
+
+	ErrInvalidReport   = newGameError(60, "invalid_report", "Reports need a reason and someone else to report")
+	ErrAlreadyReported = newGameError(61, "already_reported", "Already reported")
+)
+
+// host only actions report ErrNotHost with a message naming the action
+var (
+	ErrNotHostStart    = notHost("not_host_start", "Only host is allowed to start games")
+	ErrNotHostSettings = notHost("not_host_settings", "Only host is allowed to change settings")
+	ErrNotHostResults  = notHost("not_host_results", "Only host is allowed to skip results")
+	ErrNotHostSkip     = notHost("not_host_skip", "Only host is allowed to skip stages")
+	ErrNotHostKick     = notHost("not_host_kick", "Only host is allowed to kick players")
+	ErrNotHostMute     = notHost("not_host_mute", "Only host is allowed to mute players")
+	ErrNotHostSlowMode = notHost("not_host_slow_mode", "Only host is allowed to change slow mode")
+)
+
+// errorTranslations holds localized error messages by locale and error name,
+// errors without a translation fall back to their english message
+var errorTranslations = map[string]map[string]string{
+	"ru": {
+		"internal":                "Внутренняя ошибка сервера",
+		"unsupported_protocol":    "Неподдерживаемая версия протокола",
+		"invalid_payload":         "Некорректные данные",
+		"unknown_action":          "Неизвестное действие",
+		"protocol_not_negotiated": "Версия протокола не согласована",
+		"malformed_message":       "Некорректное сообщение",
+		"rate_limited":            "Слишком много запросов, подождите",
+		"invalid_token":           "Недействительный токен",
+		"name_taken":              "Имя уже занято",
+		"not_registered":          "Игрок не зарегистрирован",
+		"player_not_found":        "Игрок не найден",
+		"banned":                  "Вы заблокированы на этом сервере",
+		"challenge_required":      "Решите задачу перед регистрацией",
+		"invalid_proof":           "Неверное решение задачи",
+		"too_many_players":        "Слишком много игроков с вашего адреса",
+		"room_not_found":          "Комната не найдена",
+		"not_in_room":             "Игрок не в комнате",
+		"already_in_room":         "Игрок уже в комнате",
+		"leave_not_in_room":       "Вы не в комнате",
+		"not_host":                "Это может сделать только хост",
+		"not_host_start":          "Только хост может начать игру",
+		"not_host_settings":       "Только хост может менять настройки",
+		"not_host_results":        "Только хост может пропустить результаты",
+		"not_host_skip":           "Только хост может пропустить этап",
+		"not_host_kick":           "Только хост может выгонять игроков",
+		"not_host_mute":           "Только хост может запрещать игрокам писать в чат",
+		"not_host_slow_mode":      "Только хост может менять медленный режим",
+		"room_full":               "Комната заполнена",
+		"invalid_settings":        "Некорректные настройки комнаты",
+		"game_not_started":        "Игра еще не началась",
+		"too_many_rooms":          "С вашего адреса создано слишком много комнат",
+		"kick_self":               "Нельзя выгнать самого себя",
+		"game_in_progress":        "Игра уже идёт",
+		"not_writing_stage":       "Сейчас не этап ответов",
+		"not_voting_stage":        "Сейчас не этап голосования",
+		"own_answer_vote":         "Нельзя голосовать за свой ответ",
+		"answer_not_found":        "Ответ не найден",
+		"already_voted":           "Вы уже проголосовали",
+		"too_many_votes":          "Слишком много голосов",
+		"duplicate_vote":          "Нельзя голосовать за один ответ дважды",
+		"not_results_stage":       "Сейчас не этап результатов",
+		"already_answered":        "Вы уже ответили",
+		"empty_message":           "Сообщение не должно быть пустым",
+		"message_too_long":        "Сообщение слишком длинное",
+		"slow_mode":               "Включен медленный режим, подождите перед следующим сообщением",
+		"invalid_slow_mode":       fmt.Sprintf("Медленный режим должен быть от 0 до %v секунд", maxSlowMode),
+		"unknown_command":         "Неизвестная команда",
+		"invalid_command":         "Неверные аргументы команды",
+		"muted":                   "Вам запрещено писать в чат этой комнаты",
+		"whisper_disabled":        "Личные сообщения отключены, пока игроки отвечают и голосуют",
+		"whisper_self":            "Нельзя написать личное сообщение себе",
+		"inappropriate_content":   "Текст содержит запрещенные слова",
+		"invalid_reaction":        "Недопустимая реакция",
+		"message_not_found":       "Сообщение не найдено",
+		"reaction_limit":          "Слишком много реакций",
+		"own_answer_reaction":     "Нельзя реагировать на свой ответ",
+		"invalid_report":          "Жалобе нужна причина и другой игрок",
+		"already_reported":        "Жалоба уже отправлена",
+	},
+}
+
+// localize returns the error message in the given locale
+func (e *GameError) localize(locale string) string {
+	if message, ok := errorTranslations[locale][e.key]; ok {
+		return message
+	}
+	return e.Message
+}
+
+// newErrorMsg turns any handler error into a message for the client,
+// errors that are not a GameError are logged and reported as internal
+func newErrorMsg(err error, locale string) *ErrorMsg {
+	var gameErr *GameError
+	if !errors.As(err, &gameErr) {
+		activityLog("error", 0, err)
+		gameErr = ErrInternal
+	}
+	return &ErrorMsg{
+		MsgType:   "error",
+		Error:     gameErr.localize(locale),
+		ErrorCode: gameErr.Code,
+		ErrorName: gameErr.Name,
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ContentFilter finds words that are not allowed in player written text
+type ContentFilter interface {
+	// Find returns the [start, end) rune ranges of the words to filter
+	Find(text string) [][2]int
+}
+
+// Filter is applied to player names, chat messages and answers,
+// it finds nothing until a word list is loaded
+var Filter ContentFilter = wordListFilter{}
+
+// FilterMode is how a room treats text the filter finds something in
+type FilterMode string
+
+const (
+	FilterOff    FilterMode = "off"
+	FilterMask   FilterMode = "mask"
+	FilterReject FilterMode = "reject"
+)
+
+func (m FilterMode) valid() bool {
+	return m == FilterOff || m == FilterMask || m == FilterReject
+}
+
+// confusables maps letters that look like latin ones, and digits and
+// symbols used in their place, to the latin letter
+var confusables = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ç': 'c', 'è': 'e',
+	'é': 'e', 'ê': 'e', 'ë': 'e', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ù': 'u', 'ú': 'u', 'û': 'u',
+	'ü': 'u', 'ý': 'y', 'ÿ': 'y',
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// normalizeRune folds case, fullwidth forms and confusables, invisible
+// runes and combining marks are dropped by returning -1
+func normalizeRune(r rune) rune {
+	if r >= '！' && r <= '～' {
+		r -= '！' - '!'
+	}
+	if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r) {
+		return -1
+	}
+	r = unicode.ToLower(r)
+	if c, ok := confusables[r]; ok {
+		return c
+	}
+	return r
+}
+
+// normalizeWord returns the normalized form of a word list entry
+func normalizeWord(word string) string {
+	var b strings.Builder
+	for _, r := range word {
+		if r = normalizeRune(r); r >= 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// wordListFilter matches whole words after normalizing them
+type wordListFilter map[string]bool
+
+// LoadWordList reads a filter with one word per line, empty lines and
+// lines starting with # are skipped
+func LoadWordList(path string) (ContentFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	words := make(wordListFilter)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words[normalizeWord(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	fmt.Println("Loaded", len(words), "filtered words from", path)
+	return words, nil
+}
+
+func (f wordListFilter) Find(text string) [][2]int {
+	if len(f) == 0 {
+		return nil
+	}
+	var found [][2]int
+	var word strings.Builder
+	start := -1
+	i := 0
+	flush := func(end int) {
+		if start >= 0 && f[word.String()] {
+			found = append(found, [2]int{start, end})
+		}
+		word.Reset()
+		start = -1
+	}
+	for _, r := range text {
+		n := normalizeRune(r)
+		switch {
+		case n < 0:
+			// invisible runes do not split words
+		case unicode.IsLetter(n) || unicode.IsDigit(n):
+			if start < 0 {
+				start = i
+			}
+			word.WriteRune(n)
+		default:
+			flush(i)
+		}
+		i++
+	}
+	flush(i)
+	return found
+}
+
+// filterText applies the filter to text as the mode says
+func filterText(mode FilterMode, text string) (string, error) {
+	if mode == FilterOff {
+		return text, nil
+	}
+	found := Filter.Find(text)
+	if len(found) == 0 {
+		return text, nil
+	}
+	if mode == FilterReject {
+		return "", ErrInappropriateContent
+	}
+	runes := []rune(text)
+	for _, span := range found {
+		for i := span[0]; i < span[1]; i++ {
+			runes[i] = '*'
+		}
+	}
+	return string(runes), nil
+}
+
+// filterText applies the filter with the strictness chosen for the room
+func (s *GameRoom) filterText(text string) (string, error) {
+	return filterText(s.Settings.ContentFilter, text)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// host actions are shared by websocket actions and chat commands so both
+// go through the same checks
+
+func (s *GameRoom) startGame(pl *Player) error {
+	if s.GameStage != WaitingStage {
+		return ErrGameInProgress
+	}
+	if s.getHost() != pl {
+		return ErrNotHostStart
+	}
+	s.transitionStage()
+	return nil
+}
+
+func (s *GameRoom) changeSettings(pl *Player, data []byte) error {
+	if s.GameStage != WaitingStage {
+		return ErrGameInProgress
+	}
+	if s.getHost() != pl {
+		return ErrNotHostSettings
+	}
+	settings, err := s.Settings.merge(data)
+	if err != nil {
+		fmt.Println(err)
+		return ErrInvalidSettings
+	}
+	s.Settings = settings
+	s.sendState()
+	return nil
+}
+
+// skipStage ends the current stage early
+func (s *GameRoom) skipStage(pl *Player) error {
+	if s.GameStage == WaitingStage {
+		return ErrGameNotStarted
+	}
+	if s.getHost() != pl {
+		return ErrNotHostSkip
+	}
+	s.endStage()
+	return nil
+}
+
+// getPlayerByName finds a player of the room by case insensitive name
+func (s *GameRoom) getPlayerByName(name string) (*Player, error) {
+	for _, pl := range s.Players {
+		if strings.EqualFold(pl.Name, name) {
+			return pl, nil
+		}
+	}
+	return nil, ErrPlayerNotFound
+}
+
+// splitPlayerName finds the player with the longest name text starts with
+// and returns the rest of text, so chat commands work with names containing spaces
+func (s *GameRoom) splitPlayerName(text string) (*Player, string, error) {
+	var found *Player
+	rest := ""
+	for _, pl := range s.Players {
+		n := len(pl.Name)
+		if len(text) < n || !strings.EqualFold(text[:n], pl.Name) {
+			continue
+		}
+		if len(text) > n && text[n] != ' ' {
+			continue
+		}
+		if found == nil || n > len(found.Name) {
+			found, rest = pl, strings.TrimSpace(text[n:])
+		}
+	}
+	if found == nil {
+		return nil, "", ErrPlayerNotFound
+	}
+	return found, rest, nil
+}
+
+func (s *GameRoom) kickPlayer(host *Player, name string) error {
+	if s.getHost() != host {
+		return ErrNotHostKick
+	}
+	target, err := s.getPlayerByName(name)
+	if err != nil {
+		return err
+	}
+	if target == host {
+		return ErrKickSelf
+	}
+	activityLog("room", 2, "Player", target.Name, "kicked from room", s.Name)
+	target.leaveRoom()
+	target.connection.send(newSystemMsg("You were kicked from the room"))
+	return nil
+}
+
+// mutePlayer stops or allows chat messages of the player in this room
+func (s *GameRoom) mutePlayer(host *Player, name string, muted bool) error {
+	if s.getHost() != host {
+		return ErrNotHostMute
+	}
+	target, err := s.getPlayerByName(name)
+	if err != nil {
+		return err
+	}
+	s.chatMu.Lock()
+	if muted {
+		s.muted[target.id] = true
+	} else {
+		delete(s.muted, target.id)
+	}
+	s.chatMu.Unlock()
+	if muted {
+		s.sendSystemMessage(fmt.Sprintf("Player %v was muted", target.Name))
+	} else {
+		s.sendSystemMessage(fmt.Sprintf("Player %v was unmuted", target.Name))
+	}
+	return nil
+}
+
+func (s *GameRoom) isMuted(pl *Player) bool {
+	s.chatMu.Lock()
+	defer s.chatMu.Unlock()
+	return s.muted[pl.id]
+}
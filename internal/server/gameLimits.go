@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+	"github.com/sethvargo/go-limiter/memorystore"
+)
+
+// maxMessageLength is the longest chat message in characters
+const maxMessageLength = 300
+
+// caps per client address, 0 is no cap
+var (
+	MaxConnectionsPerIP = 0
+	MaxPlayersPerIP     = 0
+	MaxRoomsPerIP       = 0
+)
+
+// addrCounter counts open connections by client address
+type addrCounter struct {
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+var connectionsByIP = &addrCounter{counts: make(map[string]int)}
+
+// acquire counts a connection from the address unless it already has max of them
+func (ac *addrCounter) acquire(addr string, max int) bool {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if max > 0 && ac.counts[addr] >= max {
+		return false
+	}
+	ac.counts[addr]++
+	return true
+}
+
+func (ac *addrCounter) release(addr string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.counts[addr]--; ac.counts[addr] <= 0 {
+		delete(ac.counts, addr)
+	}
+}
+
+func (ac *addrCounter) total() int {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	total := 0
+	for _, count := range ac.counts {
+		total += count
+	}
+	return total
+}
+
+// rate limits are kept per client address, chat has its own limit so
+// talking does not use up the tokens needed to play
+var (
+	actionStore limiter.Store
+	chatStore   limiter.Store
+)
+
+// chatActions are the actions limited by chatStore
+var chatActions = map[string]bool{
+	"sendMessage": true,
+	"whisper":     true,
+	"react":       true,
+	"report":      true,
+}
+
+func initRateLimits() error {
+	var err error
+	actionStore, err = memorystore.New(&memorystore.Config{
+		// Number of tokens allowed per interval.
+		Tokens: 30,
+
+		// Interval until tokens reset.
+		Interval: time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	chatStore, err = memorystore.New(&memorystore.Config{
+		Tokens:   20,
+		Interval: time.Minute,
+	})
+	return err
+}
+
+// rateLimit takes a token for the action from the address bucket
+func rateLimit(addr string, action string) error {
+	store := actionStore
+	if chatActions[action] {
+		store = chatStore
+	}
+	_, _, _, ok, err := store.Take(context.Background(), addr)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		activityLog("conn", 1, fmt.Sprintf("address %v hit %v rate limit", addr, action))
+		countRejection(rejectRateLimit)
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -1,290 +1,397 @@
 package server
 
 import (
-	"context"
 	"embed"
-	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/sethvargo/go-limiter"
-	"github.com/sethvargo/go-limiter/memorystore"
 )
 
-var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }} // TODO: CHECK FOR ORIGIN
+var upgrader = websocket.Upgrader{
+	CheckOrigin:  checkOrigin,
+	Subprotocols: []string{msgpackSubprotocol, jsonSubprotocol},
+}
 var Server *GameServer
-var store limiter.Store
 
 var (
 	MaxPlayers        = 10
 	MaxScore          = 2
 	TimeoutMultiplier = 100
+	ResultsDuration   = 10
 )
 
 //go:embed data.txt
 var f embed.FS
 
-func InitServer(maxPlayers int, maxScore int, timeoutMultiplier int) {
+func InitServer(maxPlayers int, maxScore int, timeoutMultiplier int, resultsDuration int) {
 	MaxPlayers = maxPlayers
 	MaxScore = maxScore
 	TimeoutMultiplier = timeoutMultiplier
+	ResultsDuration = resultsDuration
 	rand.Seed(time.Now().UnixNano())
 	QuestionList, err := readLines("data.txt", f)
 	if err != nil {
 		fmt.Println(err)
 		log.Fatal("Error reading questions")
 	}
-	store, err = memorystore.New(&memorystore.Config{
-		// Number of tokens allowed per interval.
-		Tokens: 30,
-
-		// Interval until tokens reset.
-		Interval: time.Minute,
-	})
-	if err != nil {
+	if err := initRateLimits(); err != nil {
 		log.Fatal(err)
 	}
 	Server = &GameServer{
-		players:     make(map[*websocket.Conn]*Player),
-		connections: make(map[string]*websocket.Conn),
+		players:     make(map[*Client]*Player),
+		connections: make(map[string]*Client),
 		rooms:       make(map[string]*GameRoom),
+		shadowMuted: make(map[string]string),
 		questions:   QuestionList,
 	}
 }
 
-type Action struct {
-	Action string
-	Data   string
-}
-
-type ErrorMsg struct {
-	MsgType   string `json:"msgType"`
-	Error     string `json:"error"`
-	ErrorCode int    `json:"errorCode"`
-}
-
-func wsActionHandler(c *websocket.Conn, action Action) {
+// wsActionHandler runs the action sent by the client, the returned error
+// is reported back to the client
+func wsActionHandler(c *Client, action Action) error {
+	// count every request, even ones in the wrong protocol version
+	if err := rateLimit(c.addr, action.Action); err != nil {
+		return err
+	}
+	if action.version != c.version && action.Action != "hello" {
+		return ErrProtocolNotNegotiated
+	}
 	switch action.Action {
+	case "hello":
+		var payload HelloPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		if !c.negotiate(payload.Versions, payload.Locale) {
+			return ErrUnsupportedProtocol
+		}
 	case "register":
-		Server.playerRegister(c, action.Data)
+		var payload RegisterPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		if err := c.checkProof(payload.Nonce); err != nil {
+			return err
+		}
+		if err := Server.playerRegister(c, payload.Name); err != nil {
+			return err
+		}
+		// only accepted registrations make challenges harder
+		registrations.add()
+	case "challenge":
+		if PowDifficulty == 0 {
+			return ErrUnknownAction
+		}
+		c.sendChallenge()
 	case "login":
-		Server.playerLogin(c, action.Data)
+		var payload LoginPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		return Server.playerLogin(c, payload.Token)
+	case "timeSync":
+		var payload TimeSyncPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		sendTimeSync(c, payload.ClientTime)
 	case "joinRoom":
+		var payload JoinRoomPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
 		player, err := Server.getPlayerByConnection(c)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
 		if player.room != nil {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player already in a room",
-				ErrorCode: 22,
-			})
-			return
-		}
-		room, err := Server.getRoomById(action.Data)
+			return ErrAlreadyInRoom
+		}
+		room, err := Server.getRoomById(payload.Room)
 		if err != nil {
-			fmt.Println(err)
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Room not found",
-				ErrorCode: 20,
-			})
-			return
+			return err
 		}
 		if len(room.Players) == MaxPlayers {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Room is full",
-				ErrorCode: 25,
-			})
-			return
+			return ErrRoomFull
 		}
 		player.joinRoom(room)
 	case "createRoom":
 		player, err := Server.getPlayerByConnection(c)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
 		if player.room != nil {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player already in a room",
-				ErrorCode: 22,
-			})
-			return
-		}
-		player.joinRoom(Server.createRoom())
+			return ErrAlreadyInRoom
+		}
+		room, err := Server.createRoom(c.addr)
+		if err != nil {
+			return err
+		}
+		player.joinRoom(room)
 	case "leaveRoom":
-
 		player, err := Server.getPlayerByConnection(c)
 		if err != nil {
-			fmt.Println("No player found", err)
-			return
+			return err
 		}
 		if player.room == nil {
-			fmt.Println("Player not in room")
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player not in a room",
-				ErrorCode: 23,
-			})
-			return
+			return ErrLeaveNotInRoom
 		}
 		player.leaveRoom()
 	case "startGame":
-		player, err := Server.getPlayerByConnection(c)
+		player, err := Server.getPlayerInRoom(c)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
-		if player.room == nil {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player not in room",
-				ErrorCode: 21,
-			})
-			return
-		}
-		if player.room.GameStage != WaitingStage {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Game in progress",
-				ErrorCode: 30,
-			})
-			return
-		}
-		if player.room.getPlayersSlice()[0] != player {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Only host is allowed to start games",
-				ErrorCode: 24,
-			})
-			return
-		}
-		player.room.transitionStage()
-	case "sendAnswer":
-		player, err := Server.getPlayerByConnection(c)
+		return player.room.startGame(player)
+	case "changeSettings":
+		var payload SettingsPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
-		if player.room == nil {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player not in room",
-				ErrorCode: 21,
-			})
-			return
+		return player.room.changeSettings(player, payload.Settings)
+	case "sendAnswer":
+		var payload AnswerPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
 		}
 		if player.room.GameStage != WritingStage {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Not writing stage",
-				ErrorCode: 31,
-			})
-			return
+			return ErrNotWritingStage
 		}
 		// if len(action.Data) > 50
-		player.room.writingStageHandler(player, action.Data)
+		return player.room.writingStageHandler(player, payload.Answer)
 	case "voteAnswer":
-		player, err := Server.getPlayerByConnection(c)
-		if err != nil {
-			fmt.Println("Player not found", err)
-			return
+		var payload VotePayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
 		}
-		if player.room == nil {
-			fmt.Println("Player not in room")
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player not in room",
-				ErrorCode: 21,
-			})
-			return
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
 		}
 		if player.room.GameStage != VotingStage {
-			fmt.Println("Not voting stage")
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Not voting stage",
-				ErrorCode: 32,
-			})
-			return
-		}
-		player.room.votingStageHandler(player, action.Data)
+			return ErrNotVotingStage
+		}
+		return player.room.votingStageHandler(player, payload.AnswerIds)
+	case "ready", "nextRound":
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		if player.room.GameStage != WinnerStage {
+			return ErrNotResultsStage
+		}
+		if action.Action == "ready" {
+			player.room.winnerStageHandler(player)
+			return nil
+		}
+		if player.room.getHost() != player {
+			return ErrNotHostResults
+		}
+		player.room.endStage()
 	case "sendMessage":
-		player, err := Server.getPlayerByConnection(c)
+		var payload ChatPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
-		if player.room == nil {
-			c.WriteJSON(&ErrorMsg{
-				MsgType:   "error",
-				Error:     "Player not in room",
-				ErrorCode: 21,
-			})
-			return
-		}
-		if len(action.Data) == 0 {
-			return
-		}
-		player.room.broadcastMessage(
-			&struct {
-				MsgType     string `json:"msgType"`
-				Author      string `json:"author"`
-				ChatMessage string `json:"chatMessage"`
-			}{
-				MsgType:     "chat",
-				Author:      player.Name,
-				ChatMessage: action.Data,
-			})
-		player.room.sendState()
+		if isCommand(payload.Message) {
+			return runCommand(player, payload.Message)
+		}
+		message := strings.TrimPrefix(payload.Message, "/")
+		if err := player.room.checkChat(player, message); err != nil {
+			return err
+		}
+		message, err = player.room.filterText(message)
+		if err != nil {
+			return err
+		}
+		if Server.isShadowMuted(player) {
+			// the author must not notice, so the echo looks like a normal message
+			msg := newChatMsg(player.Name, message)
+			msg.Id = player.room.chat.reserveId()
+			msg.Timestamp = unixMilli(time.Now())
+			player.connection.send(msg)
+			return nil
+		}
+		player.room.sendChat(player, message)
+	case "kickPlayer":
+		var payload KickPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		return player.room.kickPlayer(player, payload.Name)
+	case "mutePlayer":
+		var payload MutePayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		return player.room.mutePlayer(player, payload.Name, payload.Muted)
+	case "setSlowMode":
+		var payload SlowModePayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		if player.room.getHost() != player {
+			return ErrNotHostSlowMode
+		}
+		return player.room.setSlowMode(payload.Seconds)
+	case "whisper":
+		var payload WhisperPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		return player.room.whisper(player, payload.To, payload.Message)
+	case "react":
+		var payload ReactPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		target := reactionTarget{answerId: payload.AnswerId, messageId: payload.MessageId}
+		return player.room.react(player, target, payload.Emoji)
+	case "report":
+		var payload ReportPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		return player.room.report(player, payload)
+	case "fetchChatHistory":
+		var payload ChatHistoryPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		if payload.Before <= 0 {
+			payload.Before = math.MaxInt64
+		}
+		if payload.Limit <= 0 || payload.Limit > chatReplaySize {
+			payload.Limit = chatReplaySize
+		}
+		player.room.sendChatHistory(player, payload.Before, payload.Limit)
+	case "resyncState":
+		var payload ResyncPayload
+		if err := action.decode(&payload); err != nil {
+			return ErrInvalidPayload
+		}
+		player, err := Server.getPlayerInRoom(c)
+		if err != nil {
+			return err
+		}
+		activityLog("room", 3, "Player", player.Name, "resyncing from revision", payload.Revision)
+		player.room.sendSnapshot(player)
+	default:
+		return ErrUnknownAction
 	}
+	return nil
 }
 
 func WsHandler(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
+	ip := clientIP(r)
+	if ip == nil {
+		activityLog("conn", 1, "Rejected connection from unparseable address", r.RemoteAddr)
+		http.Error(w, "invalid client address", http.StatusBadRequest)
+		return
+	}
+	addr := ip.String()
+	if ban := bans.check(addr, "", ""); ban != nil {
+		activityLog("conn", 1, fmt.Sprintf("Rejected banned address %v (ban %v)", addr, ban.Id))
+		countRejection(rejectBanned)
+		http.Error(w, ErrBanned.Message, http.StatusForbidden)
+		return
+	}
+	if !connectionsByIP.acquire(addr, MaxConnectionsPerIP) {
+		activityLog("conn", 1, fmt.Sprintf("Rejected connection from %v, too many open connections", addr))
+		countRejection(rejectConnectionCap)
+		http.Error(w, "too many connections", http.StatusTooManyRequests)
+		return
+	}
+	defer connectionsByIP.release(addr)
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Print("upgrade:", err)
 		return
 	}
+	c := NewClient(conn)
+	c.addr = addr
 	defer func() {
 		Server.playerDisconnect(c)
-		c.Close()
+		conn.Close()
 	}()
 
-	userAddr := strings.Split(r.RemoteAddr, ":")[0]
-	if forwardedHeader := r.Header.Get("X-Forwarded-For"); len(forwardedHeader) != 0 {
-		userAddr = strings.Split(forwardedHeader, ",")[0]
-	}
-	activityLog("conn", 2, fmt.Sprintf("Connection init with %v", userAddr))
+	activityLog("conn", 2, fmt.Sprintf("Connection init with %v", c.addr))
 	for {
-		_, message, err := c.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			log.Println("read:", err)
 			break
 		}
-		_, _, _, ok, _ := store.Take(context.Background(), userAddr)
-		if !ok {
-			activityLog("conn", 1, fmt.Sprintf("address %v hit rate limit", userAddr))
+		message, err = c.codec.toJSON(message)
+		if err != nil {
+			log.Println(err)
+			if err := rateLimit(c.addr, ""); err != nil {
+				continue
+			}
+			c.sendError(ErrMalformedMessage)
 			continue
 		}
 		activityLog("wsrecv", 4, string(message))
-		activityLog("wsrecv", 4, fmt.Sprintf("%+v", c.RemoteAddr()))
-		var action Action
-		err = json.Unmarshal(message, &action)
+		activityLog("wsrecv", 4, fmt.Sprintf("%+v", conn.RemoteAddr()))
+		action, err := parseAction(message)
 		if err != nil {
 			log.Println(err)
-			break
+			if err := rateLimit(c.addr, ""); err != nil {
+				continue
+			}
+			c.sendError(err)
+			continue
+		}
+		c.beginRequest(action)
+		if err := wsActionHandler(c, action); err != nil {
+			c.sendError(err)
 		}
-		wsActionHandler(c, action)
+		c.endRequest()
 	}
 }
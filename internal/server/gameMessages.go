@@ -0,0 +1,165 @@
+package server
+
+import "time"
+
+// Messages sent from the server to clients, every message has a msgType
+// field naming it, see outboundMessages for the full list
+
+type ErrorMsg struct {
+	MsgType   string `json:"msgType"`
+	Error     string `json:"error"`
+	ErrorCode int    `json:"errorCode"`
+	ErrorName string `json:"errorName"`
+}
+
+// WelcomeMsg confirms the protocol version picked in response to hello
+type WelcomeMsg struct {
+	MsgType   string `json:"msgType"`
+	Version   int    `json:"version"`
+	Supported []int  `json:"supported"`
+}
+
+// JwtMsg carries the token used to log back in after reconnecting
+type JwtMsg struct {
+	MsgType string `json:"msgType"`
+	Data    string `json:"data"`
+}
+
+// SelfMsg describes the receiving player
+type SelfMsg struct {
+	MsgType        string   `json:"msgType"`
+	Name           string   `json:"name"`
+	Room           string   `json:"room"`
+	ActionDone     bool     `json:"actionDone"`
+	AnswerId       string   `json:"answerId"`
+	VotedAnswerIds []string `json:"votedAnswerIds"`
+}
+
+// RoomStateMsg describes the room the receiving player is in
+type RoomStateMsg struct {
+	MsgType      string          `json:"msgType"`
+	Revision     int             `json:"revision"`
+	RoomName     string          `json:"roomName"`
+	IsHost       bool            `json:"isHost"`
+	CanVote      bool            `json:"canVote"`
+	Players      []*Player       `json:"players"`
+	Answers      []*AnswerView   `json:"answers"`
+	GameStage    Stage           `json:"gameStage"`
+	Question     string          `json:"question"`
+	Winner       *Player         `json:"winner"`
+	WinnerAnswer *GameAnswer     `json:"winnerAnswer"`
+	Results      []*AnswerResult `json:"results"`
+	Settings     RoomSettings    `json:"settings"`
+	// reaction counts by emoji, keyed by answer id and chat message id
+	AnswerReactions map[string]map[string]int `json:"answerReactions"`
+	ChatReactions   map[string]map[string]int `json:"chatReactions"`
+	Deadline        int64                     `json:"deadline"`
+	ServerTime      int64                     `json:"serverTime"`
+}
+
+// RoomStateDeltaMsg updates the room state from BaseRevision to Revision,
+// clients that don't have BaseRevision should send resyncState
+type RoomStateDeltaMsg struct {
+	MsgType      string    `json:"msgType"`
+	Revision     int       `json:"revision"`
+	BaseRevision int       `json:"baseRevision"`
+	Ops          []PatchOp `json:"ops"`
+}
+
+// ResyncMsg restores everything a reconnecting client needs to know about its room
+type ResyncMsg struct {
+	MsgType string        `json:"msgType"`
+	Self    *SelfMsg      `json:"self"`
+	State   *RoomStateMsg `json:"state"`
+	Chat    []*ChatMsg    `json:"chat"`
+}
+
+type ChatMsg struct {
+	MsgType     string `json:"msgType"`
+	Id          int64  `json:"id"`
+	Timestamp   int64  `json:"timestamp"`
+	Author      string `json:"author"`
+	ChatMessage string `json:"chatMessage"`
+	System      bool   `json:"system"`
+	// Private messages are command replies and whispers, they are not kept in history
+	Private bool `json:"private"`
+	// Recipient is set for whispers, which only the author and the recipient get
+	Recipient string `json:"recipient,omitempty"`
+	authorId  string
+}
+
+// newSystemMsg creates a private message from the server
+func newSystemMsg(message string) *ChatMsg {
+	return &ChatMsg{
+		MsgType:     "chat",
+		Timestamp:   unixMilli(time.Now()),
+		Author:      "Server",
+		ChatMessage: message,
+		System:      true,
+		Private:     true,
+	}
+}
+
+// newEchoMsg creates a private chat message that is not kept in history
+func newEchoMsg(author, message string) *ChatMsg {
+	msg := newChatMsg(author, message)
+	msg.Timestamp = unixMilli(time.Now())
+	msg.Private = true
+	return msg
+}
+
+// ChatHistoryMsg holds chat messages oldest first, HasMore tells
+// whether older messages can be fetched
+type ChatHistoryMsg struct {
+	MsgType  string     `json:"msgType"`
+	Messages []*ChatMsg `json:"messages"`
+	HasMore  bool       `json:"hasMore"`
+}
+
+func newChatMsg(author string, message string) *ChatMsg {
+	return &ChatMsg{
+		MsgType:     "chat",
+		Author:      author,
+		ChatMessage: message,
+	}
+}
+
+// ChallengeMsg asks for a nonce that makes sha256(challenge + ":" + nonce)
+// start with difficulty zero bits before registering
+type ChallengeMsg struct {
+	MsgType    string `json:"msgType"`
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// StatusMsg is broadcast to everyone on the server periodically
+type StatusMsg struct {
+	MsgType     string `json:"msgType"`
+	PlayerCount int    `json:"playerCount"`
+	RoomCount   int    `json:"roomCount"`
+}
+
+// TimeSyncMsg lets clients estimate the server clock offset
+type TimeSyncMsg struct {
+	MsgType    string `json:"msgType"`
+	ClientTime int64  `json:"clientTime"`
+	ServerTime int64  `json:"serverTime"`
+}
+
+// serverMessage is any message sent to clients, messageType names it in envelopes
+type serverMessage interface {
+	messageType() string
+}
+
+func (m *ErrorMsg) messageType() string          { return m.MsgType }
+func (m *WelcomeMsg) messageType() string        { return m.MsgType }
+func (m *JwtMsg) messageType() string            { return m.MsgType }
+func (m *SelfMsg) messageType() string           { return m.MsgType }
+func (m *RoomStateMsg) messageType() string      { return m.MsgType }
+func (m *RoomStateDeltaMsg) messageType() string { return m.MsgType }
+func (m *ResyncMsg) messageType() string         { return m.MsgType }
+func (m *ChatMsg) messageType() string           { return m.MsgType }
+func (m *ChatHistoryMsg) messageType() string    { return m.MsgType }
+func (m *ChallengeMsg) messageType() string      { return m.MsgType }
+func (m *StatusMsg) messageType() string         { return m.MsgType }
+func (m *TimeSyncMsg) messageType() string       { return m.MsgType }
@@ -0,0 +1,47 @@
+package server
+
+import "sync"
+
+// rejection reasons counted in metrics
+const (
+	rejectConnectionCap = "connectionsPerIP"
+	rejectPlayerCap     = "playersPerIP"
+	rejectRoomCap       = "roomsPerIP"
+	rejectRateLimit     = "rateLimited"
+	rejectBanned        = "banned"
+	rejectOrigin        = "origin"
+)
+
+// metrics counts rejected requests by reason since the server started
+var metrics = struct {
+	rejections map[string]int64
+	mu         sync.Mutex
+}{rejections: make(map[string]int64)}
+
+func countRejection(reason string) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.rejections[reason]++
+}
+
+// MetricsSnapshot is served by GET /admin/metrics
+type MetricsSnapshot struct {
+	Players     int              `json:"players"`
+	Rooms       int              `json:"rooms"`
+	Connections int              `json:"connections"`
+	Rejections  map[string]int64 `json:"rejections"`
+}
+
+func (gs *GameServer) metricsSnapshot() MetricsSnapshot {
+	gs.mu.Lock()
+	snapshot := MetricsSnapshot{Players: len(gs.players), Rooms: len(gs.rooms)}
+	gs.mu.Unlock()
+	snapshot.Connections = connectionsByIP.total()
+	snapshot.Rejections = make(map[string]int64)
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	for reason, count := range metrics.rejections {
+		snapshot.Rejections[reason] = count
+	}
+	return snapshot
+}
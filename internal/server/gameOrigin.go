@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowedOrigins are the origins besides the server itself that may open
+// websocket connections. Entries are hosts ("example.com"), origins with a
+// scheme ("https://example.com"), subdomain wildcards ("*.example.com") or
+// "*" for any origin, entries without a port match any port
+var AllowedOrigins []string
+
+// ParseAllowedOrigins parses a comma separated list of origins
+func ParseAllowedOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.ToLower(strings.TrimSpace(origin)); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+// originAllowed reports whether the origin matches the allowlist entry
+func originAllowed(entry string, origin *url.URL) bool {
+	if entry == "*" {
+		return true
+	}
+	host := strings.ToLower(origin.Host)
+	if i := strings.Index(entry, "://"); i >= 0 {
+		if entry[:i] != strings.ToLower(origin.Scheme) {
+			return false
+		}
+		entry = entry[i+3:]
+	}
+	if _, _, err := net.SplitHostPort(entry); err != nil {
+		// entries without a port match any port
+		host = strings.ToLower(origin.Hostname())
+	}
+	if strings.HasPrefix(entry, "*.") {
+		return strings.HasSuffix(host, entry[1:])
+	}
+	return host == entry
+}
+
+// checkOrigin allows the server's own origin and allowlisted ones, requests
+// without an Origin header come from non-browser clients and are allowed too
+func checkOrigin(r *http.Request) bool {
+	header := r.Header.Get("Origin")
+	if header == "" {
+		return true
+	}
+	origin, err := url.Parse(header)
+	if err == nil {
+		if strings.EqualFold(origin.Host, r.Host) {
+			return true
+		}
+		for _, entry := range AllowedOrigins {
+			if originAllowed(entry, origin) {
+				return true
+			}
+		}
+	}
+	activityLog("conn", 1, "Rejected websocket origin", header, "from", clientIP(r))
+	countRejection(rejectOrigin)
+	return false
+}
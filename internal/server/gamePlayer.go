@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/dchest/uniuri"
-	"github.com/gorilla/websocket"
 )
 
 type Player struct {
@@ -14,42 +13,97 @@ type Player struct {
 	Score      int  `json:"score"`
 	ActionDone bool `json:"actionDone"`
 
+	// last room state sent to the player, deltas are computed against it
+	stateRevision       int
+	lastState           interface{}
 	roomUpdateTimestamp int64
 	disconnectTimeout   *time.Timer
+	lastMessage         time.Time
 	id                  string
 	mu                  sync.Mutex
-	connection          *websocket.Conn
+	connection          *Client
 }
 
-func NewPlayer(c *websocket.Conn, name string) *Player {
+func NewPlayer(c *Client, name string) *Player {
 	return &Player{connection: c, Name: name, id: uniuri.New(), ActionDone: false}
 }
 
+// addr is the resolved client address of the player connection
+func (pl *Player) addr() string {
+	return pl.connection.addr
+}
+
 func (pl *Player) sendSelf() {
+	pl.connection.send(pl.selfMsg())
+}
+
+func (pl *Player) selfMsg() *SelfMsg {
 	roomName := ""
+	answerId := ""
+	votedAnswerIds := []string{}
 	if pl.room != nil {
 		roomName = pl.room.Name
+		if answer := pl.room.getPlayerAnswer(pl); answer != nil {
+			answerId = answer.Id
+		}
+		votedAnswerIds = pl.room.ballotOf(pl)
+	}
+	return &SelfMsg{
+		MsgType:        "self",
+		Name:           pl.Name,
+		Room:           roomName,
+		ActionDone:     pl.ActionDone,
+		AnswerId:       answerId,
+		VotedAnswerIds: votedAnswerIds,
 	}
-	pl.connection.WriteJSON(
-		&struct {
-			MsgType    string `json:"msgType"`
-			Name       string `json:"name"`
-			Room       string `json:"room"`
-			ActionDone bool   `json:"actionDone"`
-		}{
-			MsgType:    "self",
-			Name:       pl.Name,
-			Room:       roomName,
-			ActionDone: pl.ActionDone,
+}
+
+// sendState sends the room state, as a delta from the last state the player
+// has if their client supports it
+func (pl *Player) sendState(state *RoomStateMsg) {
+	tree, err := toTree(state)
+	if err != nil {
+		activityLog("player", 0, err)
+		return
+	}
+	if pl.lastState == nil || pl.connection.version < deltaProtocol {
+		pl.connection.send(state)
+	} else {
+		pl.connection.send(&RoomStateDeltaMsg{
+			MsgType:      "roomStateDelta",
+			Revision:     state.Revision,
+			BaseRevision: pl.stateRevision,
+			Ops:          diffTree("", pl.lastState, tree, nil),
 		})
+	}
+	pl.stateRevision = state.Revision
+	pl.lastState = tree
+}
+
+// rememberState records state as sent to the player by other means than sendState
+func (pl *Player) rememberState(state *RoomStateMsg) {
+	tree, err := toTree(state)
+	if err != nil {
+		activityLog("player", 0, err)
+		return
+	}
+	pl.stateRevision = state.Revision
+	pl.lastState = tree
+}
+
+// resetState makes the next room state sent to the player a full snapshot
+func (pl *Player) resetState() {
+	pl.stateRevision = 0
+	pl.lastState = nil
 }
 
 func (pl *Player) joinRoom(room *GameRoom) {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
+	pl.resetState()
 	activityLog("player", 3, "Player", pl.Name, "attempting to join room", room.Name)
 	pl.room = room
-	pl.roomUpdateTimestamp = time.Now().Unix()
+	pl.roomUpdateTimestamp = time.Now().UnixNano()
 	room.addPlayer(pl)
 	// room.Players = append(room.Players, pl)
 	pl.sendSelf()
@@ -62,3 +116,17 @@ func (pl *Player) leaveRoom() {
 	pl.room = nil
 	pl.sendSelf()
 }
+
+// disconnect drops the player from their room and closes their connection
+// with err, it takes the player lock like leaving the room does, so it is
+// safe to call from other goroutines
+func (pl *Player) disconnect(err error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.room != nil {
+		pl.room.removePlayer(pl)
+		pl.room = nil
+	}
+	pl.connection.sendError(err)
+	pl.connection.conn.Close()
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+// PowDifficulty is how many leading zero bits the proof of work before
+// registering needs, 0 turns the challenge off
+var PowDifficulty = 0
+
+// SetPowDifficulty sets PowDifficulty, leaving room for the extra bits
+// added during registration spikes within the 256 bits of a sha256 sum
+func SetPowDifficulty(difficulty int) error {
+	if difficulty < 0 || difficulty+powMaxExtra > sha256.Size*8 {
+		return fmt.Errorf("proof of work difficulty must be between 0 and %v", sha256.Size*8-powMaxExtra)
+	}
+	PowDifficulty = difficulty
+	return nil
+}
+
+const (
+	// powSpikeRate is the registrations per minute after which every
+	// doubling of the rate makes challenges one bit harder
+	powSpikeRate = 20
+	// powMaxExtra caps how much harder challenges get during a spike
+	powMaxExtra = 8
+	// powChallengeTTL is how long a challenge can be solved for
+	powChallengeTTL = 2 * time.Minute
+)
+
+// powChallenge is solved by a nonce that makes sha256(value + ":" + nonce)
+// start with difficulty zero bits
+type powChallenge struct {
+	value      string
+	difficulty int
+	expires    time.Time
+}
+
+func (ch *powChallenge) solvedBy(nonce string) bool {
+	sum := sha256.Sum256([]byte(ch.value + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= ch.difficulty
+}
+
+// rateCounter counts events over the last minute in ten second buckets
+type rateCounter struct {
+	buckets [6]int
+	current int64 // index of the current ten second interval
+	mu      sync.Mutex
+}
+
+var registrations = &rateCounter{}
+
+// advance clears the buckets of the intervals passed since the last call
+func (rc *rateCounter) advance(now time.Time) {
+	interval := now.Unix() / 10
+	for ; rc.current < interval; rc.current++ {
+		if interval-rc.current > int64(len(rc.buckets)) {
+			rc.current = interval - int64(len(rc.buckets))
+		}
+		rc.buckets[(rc.current+1)%int64(len(rc.buckets))] = 0
+	}
+}
+
+func (rc *rateCounter) add() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.advance(time.Now())
+	rc.buckets[rc.current%int64(len(rc.buckets))]++
+}
+
+func (rc *rateCounter) perMinute() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.advance(time.Now())
+	total := 0
+	for _, count := range rc.buckets {
+		total += count
+	}
+	return total
+}
+
+// powDifficulty is PowDifficulty raised by a bit for every doubling of
+// the registration rate over powSpikeRate
+func powDifficulty() int {
+	difficulty := PowDifficulty
+	for rate := registrations.perMinute(); rate > powSpikeRate && difficulty < PowDifficulty+powMaxExtra; rate /= 2 {
+		difficulty++
+	}
+	return difficulty
+}
+
+// sendChallenge gives the client a new challenge to solve before registering
+func (c *Client) sendChallenge() {
+	challenge := &powChallenge{
+		value:      uniuri.NewLen(32),
+		difficulty: powDifficulty(),
+		expires:    time.Now().Add(powChallengeTTL),
+	}
+	c.mu.Lock()
+	c.challenge = challenge
+	c.mu.Unlock()
+	c.send(&ChallengeMsg{
+		MsgType:    "challenge",
+		Challenge:  challenge.value,
+		Difficulty: challenge.difficulty,
+	})
+}
+
+// checkProof checks the nonce solves the challenge of the client, a client
+// without one gets a challenge
+func (c *Client) checkProof(nonce string) error {
+	if PowDifficulty == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	challenge := c.challenge
+	c.mu.Unlock()
+	if challenge == nil || time.Now().After(challenge.expires) {
+		c.sendChallenge()
+		return ErrChallengeRequired
+	}
+	if nonce == "" || !challenge.solvedBy(nonce) {
+		activityLog("conn", 2, "Invalid proof of work from", c.addr)
+		return ErrInvalidProof
+	}
+	c.mu.Lock()
+	c.challenge = nil
+	c.mu.Unlock()
+	return nil
+}
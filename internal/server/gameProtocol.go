@@ -0,0 +1,303 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions, legacy clients send bare {action, data} messages
+// and receive bare messages, newer ones wrap everything in an Envelope
+const (
+	legacyProtocol = 1
+	latestProtocol = 2
+
+	// deltaProtocol is the first version receiving room state deltas
+	deltaProtocol = 2
+)
+
+// Envelope wraps every message of the versioned protocol
+type Envelope struct {
+	V       int         `json:"v"`
+	Type    string      `json:"type"`
+	Id      string      `json:"id,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+type Action struct {
+	Action string
+	Data   string
+
+	// Id is the client request id of a versioned message, echoed in acks and errors
+	Id      string          `json:"-"`
+	version int             // protocol version the action was sent with
+	payload json.RawMessage // typed payload of a versioned message
+}
+
+// parseAction decodes both versioned envelopes and legacy actions
+func parseAction(message []byte) (Action, error) {
+	var msg struct {
+		Envelope
+		Payload json.RawMessage `json:"payload"`
+		Action  string
+		Data    string
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return Action{}, fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+	if msg.V == 0 {
+		return Action{Action: msg.Action, Data: msg.Data, version: legacyProtocol}, nil
+	}
+	// legacy clients never send envelopes, so a v1 envelope is as unknown as v3
+	if msg.V <= legacyProtocol || msg.V > latestProtocol {
+		return Action{}, ErrUnsupportedProtocol
+	}
+	return Action{Action: msg.Type, Id: msg.Id, version: msg.V, payload: msg.Payload}, nil
+}
+
+// actionPayload is a typed action payload that can also be read from legacy string data
+type actionPayload interface {
+	fromData(data string) error
+}
+
+// decode reads the action payload into p
+func (a *Action) decode(p actionPayload) error {
+	if a.version == legacyProtocol {
+		return p.fromData(a.Data)
+	}
+	if len(a.payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(a.payload, p)
+}
+
+type HelloPayload struct {
+	Versions []int  `json:"versions"`
+	Locale   string `json:"locale"`
+}
+
+func (p *HelloPayload) fromData(data string) error {
+	for _, field := range strings.Split(data, ",") {
+		version, err := strconv.Atoi(field)
+		if err != nil {
+			return err
+		}
+		p.Versions = append(p.Versions, version)
+	}
+	return nil
+}
+
+// RegisterPayload picks a name, Nonce solves the challenge sent by the
+// server when proof of work is on
+type RegisterPayload struct {
+	Name  string `json:"name"`
+	Nonce string `json:"nonce,omitempty"`
+}
+
+func (p *RegisterPayload) fromData(data string) error {
+	p.Name = data
+	return nil
+}
+
+type LoginPayload struct {
+	Token string `json:"token"`
+}
+
+func (p *LoginPayload) fromData(data string) error {
+	p.Token = data
+	return nil
+}
+
+type TimeSyncPayload struct {
+	ClientTime int64 `json:"clientTime"`
+}
+
+func (p *TimeSyncPayload) fromData(data string) error {
+	p.ClientTime, _ = strconv.ParseInt(data, 10, 64)
+	return nil
+}
+
+type JoinRoomPayload struct {
+	Room string `json:"room"`
+}
+
+func (p *JoinRoomPayload) fromData(data string) error {
+	p.Room = data
+	return nil
+}
+
+type SettingsPayload struct {
+	Settings json.RawMessage `json:"settings" schema:"RoomSettings"`
+}
+
+func (p *SettingsPayload) fromData(data string) error {
+	p.Settings = json.RawMessage(data)
+	return nil
+}
+
+type AnswerPayload struct {
+	Answer string `json:"answer"`
+}
+
+func (p *AnswerPayload) fromData(data string) error {
+	p.Answer = data
+	return nil
+}
+
+// abstainVote is the legacy vote data players send to skip voting in a round
+const abstainVote = "abstain"
+
+// VotePayload lists picked answers best first, no answers means abstaining
+type VotePayload struct {
+	AnswerIds []string `json:"answerIds"`
+}
+
+func (p *VotePayload) fromData(data string) error {
+	if data != abstainVote {
+		p.AnswerIds = strings.Split(data, ",")
+	}
+	return nil
+}
+
+// ReactPayload puts or removes an emoji on an answer or on a chat message
+type ReactPayload struct {
+	AnswerId  string `json:"answerId,omitempty"`
+	MessageId int64  `json:"messageId,omitempty"`
+	Emoji     string `json:"emoji"`
+}
+
+// fromData parses "answer:<id>,<emoji>" or "chat:<id>,<emoji>"
+func (p *ReactPayload) fromData(data string) error {
+	parts := strings.SplitN(data, ",", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("react data must be \"target,emoji\"")
+	}
+	p.Emoji = parts[1]
+	switch {
+	case strings.HasPrefix(parts[0], "answer:"):
+		p.AnswerId = strings.TrimPrefix(parts[0], "answer:")
+	case strings.HasPrefix(parts[0], "chat:"):
+		var err error
+		p.MessageId, err = strconv.ParseInt(strings.TrimPrefix(parts[0], "chat:"), 10, 64)
+		return err
+	default:
+		return fmt.Errorf("unknown react target %q", parts[0])
+	}
+	return nil
+}
+
+// ReportPayload flags one of a player by name, a chat message or an answer
+type ReportPayload struct {
+	Player    string `json:"player,omitempty"`
+	MessageId int64  `json:"messageId,omitempty"`
+	AnswerId  string `json:"answerId,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// fromData parses "player:<name>,<reason>", "chat:<id>,<reason>" or "answer:<id>,<reason>"
+func (p *ReportPayload) fromData(data string) error {
+	parts := strings.SplitN(data, ",", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("report data must be \"target,reason\"")
+	}
+	p.Reason = parts[1]
+	switch {
+	case strings.HasPrefix(parts[0], "player:"):
+		p.Player = strings.TrimPrefix(parts[0], "player:")
+	case strings.HasPrefix(parts[0], "answer:"):
+		p.AnswerId = strings.TrimPrefix(parts[0], "answer:")
+	case strings.HasPrefix(parts[0], "chat:"):
+		var err error
+		p.MessageId, err = strconv.ParseInt(strings.TrimPrefix(parts[0], "chat:"), 10, 64)
+		return err
+	default:
+		return fmt.Errorf("unknown report target %q", parts[0])
+	}
+	return nil
+}
+
+// WhisperPayload is a chat message to one player, To is a player name
+type WhisperPayload struct {
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+func (p *WhisperPayload) fromData(data string) error {
+	parts := strings.SplitN(data, ",", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("whisper data must be \"to,message\"")
+	}
+	p.To, p.Message = parts[0], parts[1]
+	return nil
+}
+
+// KickPayload names the player to remove from the room
+type KickPayload struct {
+	Name string `json:"name"`
+}
+
+func (p *KickPayload) fromData(data string) error {
+	p.Name = data
+	return nil
+}
+
+// MutePayload stops or allows chat messages of a player in the room
+type MutePayload struct {
+	Name  string `json:"name"`
+	Muted bool   `json:"muted"`
+}
+
+// fromData parses "<name>" to mute and "<name>,false" to unmute
+func (p *MutePayload) fromData(data string) error {
+	parts := strings.SplitN(data, ",", 2)
+	p.Name, p.Muted = parts[0], true
+	if len(parts) == 2 {
+		var err error
+		p.Muted, err = strconv.ParseBool(parts[1])
+		return err
+	}
+	return nil
+}
+
+// SlowModePayload sets the seconds between chat messages, 0 turns slow mode off
+type SlowModePayload struct {
+	Seconds int `json:"seconds"`
+}
+
+func (p *SlowModePayload) fromData(data string) error {
+	var err error
+	p.Seconds, err = strconv.Atoi(data)
+	return err
+}
+
+// ChatHistoryPayload asks for messages older than the message with id Before,
+// zero Before fetches the newest messages
+type ChatHistoryPayload struct {
+	Before int64 `json:"before"`
+	Limit  int   `json:"limit"`
+}
+
+func (p *ChatHistoryPayload) fromData(data string) error {
+	p.Before, _ = strconv.ParseInt(data, 10, 64)
+	return nil
+}
+
+// ResyncPayload is the room state revision the client has
+type ResyncPayload struct {
+	Revision int `json:"revision"`
+}
+
+func (p *ResyncPayload) fromData(data string) error {
+	p.Revision, _ = strconv.Atoi(data)
+	return nil
+}
+
+type ChatPayload struct {
+	Message string `json:"message"`
+}
+
+func (p *ChatPayload) fromData(data string) error {
+	p.Message = data
+	return nil
+}
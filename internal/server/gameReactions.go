@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// maxReactionsPerTarget is how many different emoji a player can put on one answer or message
+const maxReactionsPerTarget = 3
+
+// reactionEmojis are the only emoji players can react with
+var reactionEmojis = map[string]bool{
+	"👍":  true,
+	"👎":  true,
+	"😂":  true,
+	"❤️": true,
+	"😮":  true,
+	"🔥":  true,
+}
+
+// reactionTarget is an answer of the current round or a chat message
+type reactionTarget struct {
+	answerId  string
+	messageId int64
+}
+
+func (t reactionTarget) String() string {
+	if t.answerId != "" {
+		return t.answerId
+	}
+	return strconv.FormatInt(t.messageId, 10)
+}
+
+// react toggles the emoji of the player on the target
+func (s *GameRoom) react(pl *Player, target reactionTarget, emoji string) error {
+	if !reactionEmojis[emoji] || (target.answerId == "") == (target.messageId == 0) {
+		return ErrInvalidReaction
+	}
+	if target.answerId != "" {
+		if err := s.checkAnswerReaction(pl, target.answerId); err != nil {
+			return err
+		}
+	} else if s.chat.get(target.messageId) == nil {
+		return ErrMessageNotFound
+	}
+
+	s.chatMu.Lock()
+	emojis, ok := s.reactions[target]
+	if !ok {
+		emojis = make(map[string]map[string]bool)
+		s.reactions[target] = emojis
+	}
+	if emojis[emoji][pl.id] {
+		delete(emojis[emoji], pl.id)
+		if len(emojis[emoji]) == 0 {
+			delete(emojis, emoji)
+		}
+	} else {
+		used := 0
+		for _, players := range emojis {
+			if players[pl.id] {
+				used++
+			}
+		}
+		if used >= maxReactionsPerTarget {
+			s.chatMu.Unlock()
+			return ErrReactionLimit
+		}
+		if emojis[emoji] == nil {
+			emojis[emoji] = make(map[string]bool)
+		}
+		emojis[emoji][pl.id] = true
+	}
+	s.chatMu.Unlock()
+	s.sendState()
+	return nil
+}
+
+// checkAnswerReaction allows reactions to other players answers once they are revealed
+func (s *GameRoom) checkAnswerReaction(pl *Player, answerId string) error {
+	if s.GameStage != VotingStage && s.GameStage != WinnerStage {
+		return ErrAnswerNotFound
+	}
+	for _, answer := range s.Answers {
+		if answer.Id == answerId {
+			if answer.authorId == pl.id {
+				return ErrOwnAnswerReaction
+			}
+			return nil
+		}
+	}
+	return ErrAnswerNotFound
+}
+
+// reactionCounts returns the number of players per emoji for answer and chat targets
+func (s *GameRoom) reactionCounts() (map[string]map[string]int, map[string]map[string]int) {
+	s.chatMu.Lock()
+	defer s.chatMu.Unlock()
+	answers := make(map[string]map[string]int)
+	messages := make(map[string]map[string]int)
+	for target, emojis := range s.reactions {
+		if len(emojis) == 0 {
+			continue
+		}
+		counts := make(map[string]int)
+		for emoji, players := range emojis {
+			counts[emoji] = len(players)
+		}
+		if target.answerId != "" {
+			answers[target.String()] = counts
+		} else {
+			messages[target.String()] = counts
+		}
+	}
+	return answers, messages
+}
+
+// clearAnswerReactions drops the reactions of the previous round
+func (s *GameRoom) clearAnswerReactions() {
+	s.chatMu.Lock()
+	defer s.chatMu.Unlock()
+	for target := range s.reactions {
+		if target.answerId != "" {
+			delete(s.reactions, target)
+		}
+	}
+}
+
+// awardCrowdFavourite gives bonus points to the author of the answer with
+// the most reactions, nobody gets them on a tie
+func (s *GameRoom) awardCrowdFavourite() {
+	if s.Settings.CrowdFavourite == 0 {
+		return
+	}
+	s.chatMu.Lock()
+	var favourite string
+	best, tie := 0, false
+	for target, emojis := range s.reactions {
+		if target.answerId == "" {
+			continue
+		}
+		count := 0
+		for _, players := range emojis {
+			count += len(players)
+		}
+		if count > best {
+			favourite, best, tie = target.answerId, count, false
+		} else if count == best {
+			tie = true
+		}
+	}
+	s.chatMu.Unlock()
+	if best == 0 || tie {
+		return
+	}
+	for _, result := range s.Results {
+		if result.Id == favourite {
+			result.CrowdFavourite = true
+			result.Points += s.Settings.CrowdFavourite
+		}
+	}
+	sort.SliceStable(s.Results, func(i, j int) bool { return s.Results[i].Points > s.Results[j].Points })
+	for _, answer := range s.Answers {
+		if author, ok := s.Players[answer.authorId]; ok && answer.Id == favourite {
+			author.Score += s.Settings.CrowdFavourite
+			s.sendSystemMessage(fmt.Sprintf("%v wrote the crowd favourite", author.Name))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dchest/uniuri"
+)
+
+// maxReportReason is the longest report reason in characters
+const maxReportReason = 200
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportDismissed ReportStatus = "dismissed"
+	ReportBanned    ReportStatus = "banned"
+)
+
+// Report is a player, chat message or answer flagged by another player,
+// it keeps what was reported as it was at the time
+type Report struct {
+	Id           string       `json:"id"`
+	Created      time.Time    `json:"created"`
+	Status       ReportStatus `json:"status"`
+	Reason       string       `json:"reason"`
+	ReporterId   string       `json:"reporterId"`
+	ReporterName string       `json:"reporterName"`
+	PlayerId     string       `json:"playerId"`
+	PlayerName   string       `json:"playerName"`
+	// Target is "player", "chat" or "answer", TargetId is the message or answer id
+	Target   string `json:"target"`
+	TargetId string `json:"targetId,omitempty"`
+	Content  string `json:"content"`
+	Room     string `json:"room"`
+	Round    int    `json:"round"`
+	Question string `json:"question"`
+}
+
+// reportStore keeps reports in memory and saves them to a json file when it has a path
+type reportStore struct {
+	path    string
+	reports []*Report
+	mu      sync.Mutex
+}
+
+var reports = &reportStore{}
+
+// LoadReports makes reports persistent in the file, reports already in it are loaded
+func LoadReports(path string) error {
+	reports.mu.Lock()
+	defer reports.mu.Unlock()
+	reports.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &reports.reports)
+}
+
+// save writes all reports, the file is replaced at once so a crash can't truncate it
+func (rs *reportStore) save() error {
+	if rs.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(rs.reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(rs.path, data, 0600)
+}
+
+func (rs *reportStore) add(report *Report) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, other := range rs.reports {
+		if other.Status == ReportOpen && other.ReporterId == report.ReporterId &&
+			other.Target == report.Target && other.TargetId == report.TargetId && other.PlayerId == report.PlayerId {
+			return ErrAlreadyReported
+		}
+	}
+	rs.reports = append(rs.reports, report)
+	return rs.save()
+}
+
+// list returns the reports with the status, or all of them for an empty status
+func (rs *reportStore) list(status ReportStatus) []*Report {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	list := make([]*Report, 0)
+	for _, report := range rs.reports {
+		if status == "" || report.Status == status {
+			list = append(list, report)
+		}
+	}
+	return list
+}
+
+func (rs *reportStore) get(id string) (*Report, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, report := range rs.reports {
+		if report.Id == id {
+			return report, nil
+		}
+	}
+	return nil, fmt.Errorf("no report with id %v", id)
+}
+
+// resolve sets the status of the open reports against the player, or only
+// of the one report when byPlayer is false
+func (rs *reportStore) resolve(report *Report, status ReportStatus, byPlayer bool) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	report.Status = status
+	if byPlayer {
+		for _, other := range rs.reports {
+			if other.Status == ReportOpen && other.PlayerId == report.PlayerId {
+				other.Status = status
+			}
+		}
+	}
+	return rs.save()
+}
+
+// report flags a player, a chat message or an answer of the current round
+func (s *GameRoom) report(reporter *Player, payload ReportPayload) error {
+	reason := payload.Reason
+	if reason == "" || utf8.RuneCountInString(reason) > maxReportReason {
+		return ErrInvalidReport
+	}
+	report := &Report{
+		Id:           uniuri.New(),
+		Created:      time.Now(),
+		Status:       ReportOpen,
+		Reason:       reason,
+		ReporterId:   reporter.id,
+		ReporterName: reporter.Name,
+		Room:         s.Name,
+		Round:        s.round,
+		Question:     s.Question,
+	}
+	switch {
+	case payload.MessageId != 0:
+		msg := s.chat.get(payload.MessageId)
+		if msg == nil || msg.System {
+			return ErrMessageNotFound
+		}
+		report.Target = "chat"
+		report.TargetId = fmt.Sprint(msg.Id)
+		report.PlayerId, report.PlayerName, report.Content = msg.authorId, msg.Author, msg.ChatMessage
+	case payload.AnswerId != "":
+		if s.GameStage != VotingStage && s.GameStage != WinnerStage {
+			// answers are secret while players write them
+			return ErrAnswerNotFound
+		}
+		for _, answer := range s.Answers {
+			if answer.Id == payload.AnswerId {
+				report.PlayerId, report.PlayerName, report.Content = answer.authorId, answer.authorName, answer.Content
+			}
+		}
+		if report.PlayerId == "" {
+			return ErrAnswerNotFound
+		}
+		report.Target = "answer"
+		report.TargetId = payload.AnswerId
+	case payload.Player != "":
+		pl, err := s.getPlayerByName(payload.Player)
+		if err != nil {
+			return err
+		}
+		report.Target = "player"
+		report.PlayerId, report.PlayerName, report.Content = pl.id, pl.Name, pl.Name
+	default:
+		return ErrInvalidReport
+	}
+	if report.PlayerId == reporter.id {
+		return ErrInvalidReport
+	}
+	activityLog("report", 1, "Player", reporter.Name, "reported", report.Target, "of", report.PlayerName+":", reason)
+	return reports.add(report)
+}
@@ -12,6 +12,9 @@ import (
 
 type Stage int
 
+// stageDuration is how long players have to write or vote
+const stageDuration = 30 * time.Second
+
 const (
 	WaitingStage Stage = iota
 	WritingStage
@@ -20,10 +23,30 @@ const (
 )
 
 type GameAnswer struct {
-	Id       string `json:"id"`
-	Content  string `json:"content"`
-	authorId string
-	votes    int
+	Id         string `json:"id"`
+	Content    string `json:"content"`
+	authorId   string
+	authorName string
+	votes      int
+}
+
+// AnswerView is an answer as seen by one player
+type AnswerView struct {
+	Id      string `json:"id"`
+	Content string `json:"content"`
+	Own     bool   `json:"own"`
+}
+
+// AnswerResult is an answer revealed to players in the winner stage
+type AnswerResult struct {
+	Id      string   `json:"id"`
+	Content string   `json:"content"`
+	Author  string   `json:"author"`
+	Votes   int      `json:"votes"`
+	Points  int      `json:"points"`
+	Voters  []string `json:"voters,omitempty"`
+	// CrowdFavourite is set on the answer with the most reactions when it got bonus points
+	CrowdFavourite bool `json:"crowdFavourite,omitempty"`
 }
 
 type GameRoom struct {
@@ -33,9 +56,30 @@ type GameRoom struct {
 	Players      map[string]*Player
 	Winner       *Player
 	WinnerAnswer *GameAnswer
+	Results      []*AnswerResult
 	Question     string
+	Settings     RoomSettings
 
-	t  *time.Timer
+	ballot  Ballot
+	ballots map[string][]string // voter id to picked answer ids, best first
+	// ballotsMu guards ballots for readers that may not hold mu, writers hold both
+	ballotsMu sync.Mutex
+	t         *time.Timer
+	// deadline is when t fires, zero if the stage has no time limit
+	deadline time.Time
+	// graced holds the players that got reconnect grace in the current stage
+	graced   map[string]bool
+	revision int // incremented on every state change
+	// creatorAddr is the address of the client that created the room
+	creatorAddr string
+	// round counts rounds played in the room, for reports
+	round int
+	chat  *chatHistory
+	muted map[string]bool
+	// reactions holds player ids by target and emoji
+	reactions map[reactionTarget]map[string]map[string]bool
+	chatMu    sync.Mutex
+	// c ends the current stage early, see endStage
 	c  chan struct{}
 	mu sync.Mutex
 }
@@ -67,34 +111,110 @@ func NewGameRoom() *GameRoom {
 	return &GameRoom{
 		Name:      uniuri.NewLenChars(8, []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")),
 		GameStage: WaitingStage,
-		c:         make(chan struct{}),
 		Players:   make(map[string]*Player),
 		Question:  "",
+		Settings:  defaultRoomSettings(),
+		chat:      newChatHistory(chatHistorySize),
+		muted:     make(map[string]bool),
+		reactions: make(map[reactionTarget]map[string]map[string]bool),
 	}
 }
 
-func (s *GameRoom) broadcastMessage(message interface{}) {
+func (s *GameRoom) getHost() *Player {
+	players := s.getPlayersSlice()
+	if len(players) == 0 {
+		return nil
+	}
+	return players[0]
+}
+
+func (s *GameRoom) broadcastMessage(message serverMessage) {
 	activityLog("room", 3, fmt.Sprintf("Broadcast in room %v: %+v %p\n", s.Name, message, &s))
 	for _, player := range s.Players {
-		player.connection.WriteJSON(message)
+		player.connection.send(message)
 	}
 }
 
+// sendChat broadcasts a chat message and keeps it in the room chat history
+func (s *GameRoom) sendChat(author *Player, message string) {
+	msg := newChatMsg(author.Name, message)
+	msg.authorId = author.id
+	s.addChat(msg)
+	s.broadcastMessage(msg)
+}
+
+// addChat keeps the message in the history and drops the reactions of the message it replaces
+func (s *GameRoom) addChat(msg *ChatMsg) {
+	if evicted := s.chat.add(msg); evicted != 0 {
+		s.chatMu.Lock()
+		delete(s.reactions, reactionTarget{messageId: evicted})
+		s.chatMu.Unlock()
+	}
+}
+
+// sendSystemMessage sends a chat message from the server
+func (s *GameRoom) sendSystemMessage(message string) {
+	msg := newChatMsg("Server", message)
+	msg.System = true
+	s.addChat(msg)
+	s.broadcastMessage(msg)
+}
+
+// sendChatHistory sends up to limit chat messages older than before to the player
+func (s *GameRoom) sendChatHistory(pl *Player, before int64, limit int) {
+	messages, hasMore := s.chat.before(before, limit)
+	pl.connection.send(&ChatHistoryMsg{
+		MsgType:  "chatHistory",
+		Messages: messages,
+		HasMore:  hasMore,
+	})
+}
+
+// replayChat sends recent chat to pl as a chatHistory message, legacy
+// clients only know plain chat messages and get one for each
+func (s *GameRoom) replayChat(pl *Player) {
+	messages, hasMore := s.chat.latest(chatReplaySize)
+	if pl.connection.version == legacyProtocol {
+		for _, msg := range messages {
+			pl.connection.send(msg)
+		}
+		return
+	}
+	pl.connection.send(&ChatHistoryMsg{
+		MsgType:  "chatHistory",
+		Messages: messages,
+		HasMore:  hasMore,
+	})
+}
+
+// resyncPlayer sends the full room state, the player status and recent chat
+// to a reconnecting player only
+func (s *GameRoom) resyncPlayer(pl *Player) {
+	pl.resetState()
+	state := s.stateView(pl, s.getPlayersSlice())
+	if pl.connection.version < deltaProtocol {
+		pl.sendSelf()
+		pl.sendState(state)
+		s.replayChat(pl)
+		return
+	}
+	chat, _ := s.chat.latest(chatReplaySize)
+	pl.connection.send(&ResyncMsg{
+		MsgType: "resync",
+		Self:    pl.selfMsg(),
+		State:   state,
+		Chat:    chat,
+	})
+	pl.rememberState(state)
+}
+
 func (s *GameRoom) addPlayer(pl *Player) {
 	s.mu.Lock()
 	s.Players[pl.id] = pl
 	// todo: check if player joining mid game works
 	s.mu.Unlock()
-	s.broadcastMessage(
-		&struct {
-			MsgType     string `json:"msgType"`
-			Author      string `json:"author"`
-			ChatMessage string `json:"chatMessage"`
-		}{
-			MsgType:     "chat",
-			Author:      "Server",
-			ChatMessage: fmt.Sprintf("Player %v has joined", pl.Name),
-		})
+	s.replayChat(pl)
+	s.sendSystemMessage(fmt.Sprintf("Player %v has joined", pl.Name))
 	s.sendState()
 }
 
@@ -105,16 +225,7 @@ func (s *GameRoom) removePlayer(pl *Player) {
 	delete(s.Players, pl.id)
 	// todo: fixup game state on player disconnect
 	s.mu.Unlock()
-	s.broadcastMessage(
-		&struct {
-			MsgType     string `json:"msgType"`
-			Author      string `json:"author"`
-			ChatMessage string `json:"chatMessage"`
-		}{
-			MsgType:     "chat",
-			Author:      "Server",
-			ChatMessage: fmt.Sprintf("Player %v has left", pl.Name),
-		})
+	s.sendSystemMessage(fmt.Sprintf("Player %v has left", pl.Name))
 	s.sendState()
 }
 
@@ -134,27 +245,80 @@ func (s *GameRoom) resetPlayerScore() {
 	}
 }
 
+// sendState broadcasts a new revision of the room state
 func (s *GameRoom) sendState() {
-	s.broadcastMessage(
-		&struct {
-			MsgType      string        `json:"msgType"`
-			RoomName     string        `json:"roomName"`
-			Players      []*Player     `json:"players"`
-			Answers      []*GameAnswer `json:"answers"` // TODO: Randomize answer order
-			GameStage    Stage         `json:"gameStage"`
-			Question     string        `json:"question"`
-			Winner       *Player       `json:"winner"`
-			WinnerAnswer *GameAnswer   `json:"winnerAnswer"`
-		}{
-			MsgType:      "roomState",
-			RoomName:     s.Name,
-			Players:      s.getPlayersSlice(),
-			Answers:      s.Answers,
-			GameStage:    s.GameStage,
-			Question:     s.Question,
-			Winner:       s.Winner,
-			WinnerAnswer: s.WinnerAnswer,
-		})
+	s.revision++
+	players := s.getPlayersSlice()
+	activityLog("room", 3, fmt.Sprintf("State revision %v in room %v", s.revision, s.Name))
+	for _, player := range players {
+		player.sendState(s.stateView(player, players))
+	}
+}
+
+// sendStateExcept sends the room state to everyone but pl
+func (s *GameRoom) sendStateExcept(pl *Player) {
+	s.revision++
+	players := s.getPlayersSlice()
+	for _, player := range players {
+		if player != pl {
+			player.sendState(s.stateView(player, players))
+		}
+	}
+}
+
+// sendSnapshot sends the full current room state to a single player
+func (s *GameRoom) sendSnapshot(pl *Player) {
+	pl.resetState()
+	pl.sendState(s.stateView(pl, s.getPlayersSlice()))
+}
+
+// stateView builds the room state as seen by viewer, players is the room
+// player list in join order
+func (s *GameRoom) stateView(viewer *Player, players []*Player) *RoomStateMsg {
+	// decided before players may be replaced by copies without ids
+	isHost := len(players) > 0 && players[0] == viewer
+	if s.Settings.HideProgress && s.GameStage != WinnerStage {
+		// only the viewer knows whether they are done
+		visiblePlayers := make([]*Player, 0, len(players))
+		for _, pl := range players {
+			visiblePlayers = append(visiblePlayers, &Player{
+				Name:       pl.Name,
+				Score:      pl.Score,
+				ActionDone: pl.ActionDone && pl == viewer,
+			})
+		}
+		players = visiblePlayers
+	}
+	answers := make([]*AnswerView, 0, len(s.Answers))
+	for _, answer := range s.Answers {
+		own := answer.authorId == viewer.id
+		if s.GameStage == WritingStage && !own {
+			// answers of other players stay secret until voting
+			continue
+		}
+		answers = append(answers, &AnswerView{Id: answer.Id, Content: answer.Content, Own: own})
+	}
+	answerReactions, chatReactions := s.reactionCounts()
+	return &RoomStateMsg{
+		MsgType:      "roomState",
+		Revision:     s.revision,
+		RoomName:     s.Name,
+		IsHost:       isHost,
+		CanVote:      s.GameStage == VotingStage && !viewer.ActionDone,
+		Players:      players,
+		Answers:      answers,
+		GameStage:    s.GameStage,
+		Question:     s.Question,
+		Winner:       s.Winner,
+		WinnerAnswer: s.WinnerAnswer,
+		Results:      s.Results,
+		Settings:     s.Settings,
+
+		AnswerReactions: answerReactions,
+		ChatReactions:   chatReactions,
+		Deadline:        unixMilli(s.deadline),
+		ServerTime:      unixMilli(time.Now()),
+	}
 }
 
 func (s *GameRoom) transitionStage() {
@@ -169,31 +333,7 @@ func (s *GameRoom) transitionStage() {
 		}
 		s.resetPlayerScore()
 		s.resetPlayerStatus()
-		s.Answers = make([]*GameAnswer, 0) // init answers
-		s.GameStage = WritingStage
-		s.Question = Server.questions[rand.Intn(len(Server.questions))]
-		s.t = time.NewTimer((30 * time.Second * time.Duration(TimeoutMultiplier)))
-		go func() {
-			// wait for either the timer or the channel
-			select {
-			case <-s.t.C: // todo: cleanup, remove duplicate code
-				s.mu.Lock()
-				fmt.Println("Writing Stage timeout")
-
-			case <-s.c:
-				s.mu.Lock()
-				fmt.Println("Writing Stage end")
-				s.t.Stop()
-			}
-			s.t = nil
-			s.resetPlayerStatus()
-			s.mu.Unlock()
-			if s.GameStage == WritingStage {
-				s.transitionStage()
-			}
-
-		}()
-		s.sendState()
+		s.startRound()
 
 	case WritingStage:
 		// finish writing answers
@@ -205,39 +345,31 @@ func (s *GameRoom) transitionStage() {
 		}
 		if len(s.Answers) == 1 {
 			// only one person answered, give them a technical win
-			s.Players[s.Answers[0].authorId].Score++
+			s.WinnerAnswer = s.Answers[0]
+			s.Winner = s.Players[s.Answers[0].authorId]
+			if s.Winner != nil {
+				s.Winner.Score++
+			}
+			s.buildResults()
 			s.GameStage = WinnerStage
+			s.startStageTimer(WinnerStage, s.resultsDuration())
 			s.sendState()
 			return
 		}
 		s.GameStage = VotingStage
+		s.ballot, _ = newBallot(s.Settings.BallotType, s.Settings.MaxVotes) // settings are validated on change
+		s.ballotsMu.Lock()
+		s.ballots = make(map[string][]string)
+		s.ballotsMu.Unlock()
 		rand.Shuffle(
 			len(s.Answers),
 			func(i, j int) { s.Answers[i], s.Answers[j] = s.Answers[j], s.Answers[i] },
 		)
-		s.t = time.NewTimer((30 * time.Second * time.Duration(TimeoutMultiplier)))
-		go func() {
-			// wait for either the timer or the channel
-			select {
-			case <-s.t.C: // todo: cleanup, remove duplicate code
-				fmt.Println("Voting Stage timeout")
-				s.mu.Lock()
-			case <-s.c:
-				fmt.Println("Voting Stage end")
-				s.mu.Lock()
-				s.t.Stop()
-			}
-			s.t = nil
-			s.resetPlayerStatus()
-			s.mu.Unlock()
-			if s.GameStage == VotingStage {
-				s.transitionStage()
-			}
-
-		}()
+		s.startStageTimer(VotingStage, stageDuration*time.Duration(TimeoutMultiplier))
 		s.sendState()
 	case VotingStage:
 		// finish voting
+		s.tallyBallots()
 		bestAnswer := s.Answers[0]
 
 		// todo: if multiple answers scored the same, the first one wins,
@@ -248,112 +380,301 @@ func (s *GameRoom) transitionStage() {
 			}
 		}
 		s.WinnerAnswer = bestAnswer
+		// the author may have left during the round
+		s.Winner = s.Players[bestAnswer.authorId]
+		s.buildResults()
+		s.awardCrowdFavourite()
+		s.GameStage = WinnerStage
+		if s.Winner != nil {
+			s.Winner.Score++
+			fmt.Printf("Player %v won the round\n", s.Winner.Name)
+		}
+		s.startStageTimer(WinnerStage, s.resultsDuration())
+		s.sendState()
+	case WinnerStage:
+		// finish showing results
 		for _, pl := range s.Players {
-			if bestAnswer.authorId == pl.id {
-				s.Winner = pl
+			if pl.Score >= s.Settings.MaxScore {
+				s.GameStage = WaitingStage // TODO: set stage based on winner score
+				s.resetPlayerScore()
+				s.sendState()
+				return
 			}
 		}
-		s.GameStage = WinnerStage
-		s.Winner.Score++
-		fmt.Printf("Player %v won the round\n", s.Winner.Name)
-		s.sendState()
-		go func() {
-			// tempTimer := time.NewTimer(3600 * time.Second) // winner message timeout
-			// <-tempTimer.C
+		s.startRound()
+	}
+}
+
+// startRound picks a new question and opens the writing stage
+func (s *GameRoom) startRound() {
+	s.Answers = make([]*GameAnswer, 0) // init answers
+	s.ballotsMu.Lock()
+	s.ballots = nil
+	s.ballotsMu.Unlock()
+	s.Results = nil
+	s.Winner = nil
+	s.WinnerAnswer = nil
+	s.round++
+	s.clearAnswerReactions()
+	s.GameStage = WritingStage
+	s.Question = Server.questions[rand.Intn(len(Server.questions))]
+	s.startStageTimer(WritingStage, stageDuration*time.Duration(TimeoutMultiplier))
+	s.sendState()
+}
+
+func (s *GameRoom) resultsDuration() time.Duration {
+	return time.Duration(s.Settings.ResultsDuration) * time.Second
+}
+
+// startStageTimer moves the room past stage once the timer fires
+// or endStage is called, whichever comes first
+func (s *GameRoom) startStageTimer(stage Stage, duration time.Duration) {
+	t := time.NewTimer(duration)
+	// every stage gets its own buffered channel, so an early end is never
+	// lost and can't spill over into the next stage
+	done := make(chan struct{}, 1)
+	s.t = t
+	s.c = done
+	s.deadline = time.Now().Add(duration)
+	s.graced = make(map[string]bool)
+	go func() {
+		// wait for either the timer or the channel
+		select {
+		case <-t.C:
 			s.mu.Lock()
-			defer s.mu.Unlock()
-			s.resetPlayerStatus()
-			for _, pl := range s.Players {
-				if pl.Score >= MaxScore {
-					s.GameStage = WaitingStage // TODO: set stage based on winner score
-					s.resetPlayerScore()
-					s.sendState()
-					return
-				}
-			}
-			s.Answers = make([]*GameAnswer, 0) // init answers
-			s.GameStage = WritingStage
-			s.Question = Server.questions[rand.Intn(len(Server.questions))]
-			s.t = time.NewTimer((30 * time.Second * time.Duration(TimeoutMultiplier)))
-			go func() {
-				// wait for either the timer or the channel
-				select {
-				case <-s.t.C: // todo: cleanup, remove duplicate code
-					s.mu.Lock()
-					fmt.Println("Writing Stage timeout")
-
-				case <-s.c:
-					s.mu.Lock()
-					fmt.Println("Writing Stage end")
-					s.t.Stop()
-				}
-				s.t = nil
-				s.resetPlayerStatus()
-				s.mu.Unlock()
-				if s.GameStage == WritingStage {
-					s.transitionStage()
-				}
+			fmt.Println("Stage", stage, "timeout")
+		case <-done:
+			s.mu.Lock()
+			fmt.Println("Stage", stage, "end")
+			t.Stop()
+		}
+		s.t = nil
+		s.c = nil
+		s.deadline = time.Time{}
+		s.resetPlayerStatus()
+		s.mu.Unlock()
+		if s.GameStage == stage {
+			s.transitionStage()
+		}
+	}()
+}
 
-			}()
-			s.sendState()
-		}()
+// extendDeadline gives pl more time in the current stage after reconnecting,
+// at most once per stage. It reports whether the deadline moved, the caller
+// is responsible for telling the room
+func (s *GameRoom) extendDeadline(pl *Player, by time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t == nil || s.graced[pl.id] || !s.t.Stop() {
+		return false
+	}
+	s.graced[pl.id] = true
+	s.deadline = s.deadline.Add(by)
+	s.t.Reset(time.Until(s.deadline))
+	activityLog("room", 3, "Extended deadline in room", s.Name, "to", s.deadline, "for", pl.Name)
+	return true
+}
+
+// endStage ends the current stage early, does nothing if the stage timer
+// has already fired, it must not be called with s.mu held
+func (s *GameRoom) endStage() {
+	s.mu.Lock()
+	done := s.c
+	s.mu.Unlock()
+	if done == nil {
+		return
+	}
+	select {
+	case done <- struct{}{}:
+	default:
+		// the stage is already ending
 	}
 }
 
 // handle writing stage messages from players
-func (s *GameRoom) writingStageHandler(author *Player, message string) {
+func (s *GameRoom) writingStageHandler(author *Player, message string) error {
 	if len(message) < 1 {
 		// message must not be empty
-		return
+		return ErrEmptyMessage
+	}
+	message, err := s.filterText(message)
+	if err != nil {
+		return err
 	}
 	for _, answer := range s.Answers {
 		if answer.authorId == author.id {
 			// player already submitted an answer
-			return
+			return ErrAlreadyAnswered
 		}
 	}
 	s.mu.Lock()
 	fmt.Printf("Received writing stage message %v from player %v, current state: %+v\n", message, author.Name, s)
-	defer s.mu.Unlock()
 	s.Answers = append(s.Answers,
 		&GameAnswer{
-			authorId: author.id,
-			votes:    0,
-			Id:       uniuri.New(),
-			Content:  message,
+			authorId:   author.id,
+			authorName: author.Name,
+			votes:      0,
+			Id:         uniuri.New(),
+			Content:    message,
 		})
 	author.ActionDone = true
+	allAnswered := len(s.Answers) == len(s.Players)
 	s.sendState()
 	author.sendSelf()
-	if len(s.Answers) == len(s.Players) {
+	s.mu.Unlock()
+	if allAnswered {
 		fmt.Println("All players finished writing")
-		s.c <- struct{}{}
+		s.endStage()
 	}
+	return nil
 }
 
-// handle voting stage messages from players
-func (s *GameRoom) votingStageHandler(author *Player, answerId string) {
+// handle voting stage messages from players,
+// answerIds lists picked answers best first, empty when abstaining
+func (s *GameRoom) votingStageHandler(author *Player, answerIds []string) error {
 	// you can only vote once
 	if author.ActionDone {
 		fmt.Println("Player already voted")
-		return
+		return ErrAlreadyVoted
 	}
 	s.mu.Lock()
-	fmt.Printf("Received voting stage message %v from player %v, current state: %+v\n", answerId, author.Name, s)
-	for _, answer := range s.Answers {
-		if answer.Id == answerId {
-			answer.votes++
-			author.ActionDone = true
+	fmt.Printf("Received voting stage message %v from player %v, current state: %+v\n", answerIds, author.Name, s)
+	if len(answerIds) > 0 {
+		if err := s.validateBallot(author, answerIds); err != nil {
+			s.mu.Unlock()
+			return err
 		}
+		s.ballotsMu.Lock()
+		s.ballots[author.id] = answerIds
+		s.ballotsMu.Unlock()
 	}
+	author.ActionDone = true
 	s.mu.Unlock()
 	s.sendState()
 	author.sendSelf()
 	for _, pl := range s.Players {
 		if !pl.ActionDone {
-			return
+			return nil
 		}
 	}
 	fmt.Println("All players finished voting")
-	s.c <- struct{}{}
+	s.endStage()
+	return nil
+}
+
+// handle ready messages from players looking at the round results
+func (s *GameRoom) winnerStageHandler(author *Player) {
+	s.mu.Lock()
+	author.ActionDone = true
+	s.mu.Unlock()
+	s.sendState()
+	author.sendSelf()
+	for _, pl := range s.Players {
+		if !pl.ActionDone {
+			return
+		}
+	}
+	fmt.Println("All players are ready")
+	s.endStage()
+}
+
+// validateBallot checks picked answer ids against the room ballot rules
+func (s *GameRoom) validateBallot(author *Player, choices []string) error {
+	eligible := len(s.Answers)
+	if s.getPlayerAnswer(author) != nil {
+		eligible--
+	}
+	if len(choices) > s.ballot.maxChoices(eligible) {
+		return ErrTooManyVotes
+	}
+	picked := make(map[string]bool)
+	for _, answerId := range choices {
+		var votedAnswer *GameAnswer
+		for _, answer := range s.Answers {
+			if answer.Id == answerId {
+				votedAnswer = answer
+			}
+		}
+		if votedAnswer == nil {
+			return ErrAnswerNotFound
+		}
+		if votedAnswer.authorId == author.id {
+			return ErrOwnAnswerVote
+		}
+		if picked[answerId] {
+			return ErrDuplicateVote
+		}
+		picked[answerId] = true
+	}
+	return nil
+}
+
+// tallyBallots scores answers from the ballots cast in the voting stage
+func (s *GameRoom) tallyBallots() {
+	for _, answer := range s.Answers {
+		answer.votes = 0
+	}
+	for voterId, choices := range s.ballots {
+		eligible := len(s.Answers)
+		for _, answer := range s.Answers {
+			if answer.authorId == voterId {
+				eligible--
+			}
+		}
+		for rank, answerId := range choices {
+			for _, answer := range s.Answers {
+				if answer.Id == answerId {
+					answer.votes += s.ballot.points(rank, eligible)
+				}
+			}
+		}
+	}
+}
+
+// buildResults reveals authors and votes of every answer, best first
+func (s *GameRoom) buildResults() {
+	voters := make(map[string][]string)
+	for voterId, choices := range s.ballots {
+		voterName := ""
+		if voter, ok := s.Players[voterId]; ok {
+			voterName = voter.Name
+		}
+		for _, answerId := range choices {
+			voters[answerId] = append(voters[answerId], voterName)
+		}
+	}
+	s.Results = make([]*AnswerResult, 0, len(s.Answers))
+	for _, answer := range s.Answers {
+		result := &AnswerResult{
+			Id:      answer.Id,
+			Content: answer.Content,
+			Author:  answer.authorName,
+			Votes:   len(voters[answer.Id]),
+			Points:  answer.votes,
+		}
+		if s.Settings.RevealVoters {
+			sort.Strings(voters[answer.Id])
+			result.Voters = voters[answer.Id]
+		}
+		s.Results = append(s.Results, result)
+	}
+	sort.SliceStable(s.Results, func(i, j int) bool { return s.Results[i].Points > s.Results[j].Points })
+}
+
+// getPlayerAnswer returns the answer submitted by the player in the current round
+// ballotOf returns a copy of the answer ids pl voted for, it is safe to call
+// with or without mu held
+func (s *GameRoom) ballotOf(pl *Player) []string {
+	s.ballotsMu.Lock()
+	defer s.ballotsMu.Unlock()
+	return append([]string{}, s.ballots[pl.id]...)
+}
+
+func (s *GameRoom) getPlayerAnswer(pl *Player) *GameAnswer {
+	for _, answer := range s.Answers {
+		if answer.authorId == pl.id {
+			return answer
+		}
+	}
+	return nil
 }
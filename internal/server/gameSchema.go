@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// inboundActions lists every action handled by wsActionHandler with its payload,
+// actions without a payload map to nil
+var inboundActions = map[string]actionPayload{
+	"hello":            &HelloPayload{},
+	"register":         &RegisterPayload{},
+	"login":            &LoginPayload{},
+	"timeSync":         &TimeSyncPayload{},
+	"joinRoom":         &JoinRoomPayload{},
+	"createRoom":       nil,
+	"leaveRoom":        nil,
+	"startGame":        nil,
+	"changeSettings":   &SettingsPayload{},
+	"sendAnswer":       &AnswerPayload{},
+	"voteAnswer":       &VotePayload{},
+	"ready":            nil,
+	"nextRound":        nil,
+	"sendMessage":      &ChatPayload{},
+	"resyncState":      &ResyncPayload{},
+	"fetchChatHistory": &ChatHistoryPayload{},
+	"setSlowMode":      &SlowModePayload{},
+	"kickPlayer":       &KickPayload{},
+	"mutePlayer":       &MutePayload{},
+	"whisper":          &WhisperPayload{},
+	"react":            &ReactPayload{},
+	"report":           &ReportPayload{},
+	"challenge":        nil,
+}
+
+// outboundMessages lists every message the server sends by msgType
+var outboundMessages = map[string]interface{}{
+	"error":          &ErrorMsg{},
+	"welcome":        &WelcomeMsg{},
+	"jwt":            &JwtMsg{},
+	"self":           &SelfMsg{},
+	"roomState":      &RoomStateMsg{},
+	"roomStateDelta": &RoomStateDeltaMsg{},
+	"resync":         &ResyncMsg{},
+	"challenge":      &ChallengeMsg{},
+	"chatHistory":    &ChatHistoryMsg{},
+	"chat":           &ChatMsg{},
+	"status":         &StatusMsg{},
+	"timeSync":       &TimeSyncMsg{},
+}
+
+type jsonSchema map[string]interface{}
+
+// schemaBuilder collects schemas of named struct types reachable from the protocol
+type schemaBuilder struct {
+	defs map[string]jsonSchema
+	// properties of every def in declaration order
+	order map[string][]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	b := &schemaBuilder{defs: make(map[string]jsonSchema), order: make(map[string][]string)}
+	b.typeSchema(reflect.TypeOf(Envelope{}))
+	for _, payload := range inboundActions {
+		if payload != nil {
+			b.typeSchema(reflect.TypeOf(payload))
+		}
+	}
+	for msgType, msg := range outboundMessages {
+		name := b.structSchema(reflect.TypeOf(msg).Elem())
+		b.defs[name]["properties"].(jsonSchema)["msgType"] = jsonSchema{"const": msgType}
+	}
+	return b
+}
+
+func ref(name string) jsonSchema {
+	return jsonSchema{"$ref": "#/$defs/" + name}
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) jsonSchema {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return jsonSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema{"oneOf": []jsonSchema{b.typeSchema(t.Elem()), {"type": "null"}}}
+	case reflect.Struct:
+		return ref(b.structSchema(t))
+	case reflect.Slice, reflect.Array:
+		items := t.Elem()
+		if items.Kind() == reflect.Ptr {
+			items = items.Elem() // the server never sends null items
+		}
+		return jsonSchema{"type": []string{"array", "null"}, "items": b.typeSchema(items)}
+	case reflect.Map:
+		return jsonSchema{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	}
+	return jsonSchema{}
+}
+
+// structSchema adds the def of a named struct type and returns its name
+func (b *schemaBuilder) structSchema(t reflect.Type) string {
+	name := t.Name()
+	if _, ok := b.defs[name]; ok {
+		return name
+	}
+	properties := jsonSchema{}
+	required := []string{}
+	def := jsonSchema{"type": "object", "properties": properties}
+	b.defs[name] = def
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		property := field.Name
+		if tag[0] != "" {
+			property = tag[0]
+		}
+		if refName := field.Tag.Get("schema"); refName != "" {
+			// raw json documented as a (partial) named type
+			properties[property] = ref(refName)
+		} else {
+			properties[property] = b.typeSchema(field.Type)
+		}
+		b.order[name] = append(b.order[name], property)
+		omitempty := false
+		for _, option := range tag[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		if !omitempty {
+			required = append(required, property)
+		}
+	}
+	def["required"] = required
+	return name
+}
+
+// JSONSchema returns the JSON Schema of every inbound action and outbound message
+func JSONSchema() ([]byte, error) {
+	b := newSchemaBuilder()
+	actions := jsonSchema{}
+	for action, payload := range inboundActions {
+		if payload == nil {
+			actions[action] = jsonSchema{"type": "object"}
+			continue
+		}
+		actions[action] = ref(reflect.TypeOf(payload).Elem().Name())
+	}
+	messages := jsonSchema{}
+	for msgType, msg := range outboundMessages {
+		messages[msgType] = ref(reflect.TypeOf(msg).Elem().Name())
+	}
+	schema := jsonSchema{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"title":    "UntitledWordGame protocol",
+		"version":  latestProtocol,
+		"$defs":    b.defs,
+		"actions":  actions,
+		"messages": messages,
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(schema); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TypeScript returns TypeScript definitions of every inbound action and outbound message
+func TypeScript() []byte {
+	b := newSchemaBuilder()
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by \"fgame schema\"; DO NOT EDIT.\n")
+	fmt.Fprintf(&buf, "\nexport const protocolVersion = %v;\n", latestProtocol)
+	for _, name := range sortedKeys(b.defs) {
+		def := b.defs[name]
+		properties := def["properties"].(jsonSchema)
+		required := make(map[string]bool)
+		for _, property := range def["required"].([]string) {
+			required[property] = true
+		}
+		fmt.Fprintf(&buf, "\nexport interface %v {\n", name)
+		for _, property := range b.order[name] {
+			optional := ""
+			if !required[property] {
+				optional = "?"
+			}
+			fmt.Fprintf(&buf, "  %v%v: %v;\n", property, optional, tsType(properties[property].(jsonSchema)))
+		}
+		buf.WriteString("}\n")
+	}
+
+	buf.WriteString("\nexport type ServerMessage =\n")
+	msgTypes := sortedKeys(outboundMessages)
+	for i, msgType := range msgTypes {
+		end := ""
+		if i == len(msgTypes)-1 {
+			end = ";"
+		}
+		fmt.Fprintf(&buf, "  | %v%v\n", reflect.TypeOf(outboundMessages[msgType]).Elem().Name(), end)
+	}
+
+	buf.WriteString("\nexport interface ActionPayloads {\n")
+	for _, action := range sortedKeys(inboundActions) {
+		payload := "Record<string, never>"
+		if inboundActions[action] != nil {
+			payload = reflect.TypeOf(inboundActions[action]).Elem().Name()
+		}
+		fmt.Fprintf(&buf, "  %v: %v;\n", action, payload)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func tsType(schema jsonSchema) string {
+	if refName, ok := schema["$ref"].(string); ok {
+		return strings.TrimPrefix(refName, "#/$defs/")
+	}
+	if value, ok := schema["const"]; ok {
+		return fmt.Sprintf("'%v'", value)
+	}
+	if variants, ok := schema["oneOf"].([]jsonSchema); ok {
+		types := make([]string, 0, len(variants))
+		for _, variant := range variants {
+			types = append(types, tsType(variant))
+		}
+		return strings.Join(types, " | ")
+	}
+	switch schemaType := schema["type"].(type) {
+	case []string: // nullable array
+		return fmt.Sprintf("%v[] | null", tsType(schema["items"].(jsonSchema)))
+	case string:
+		switch schemaType {
+		case "string":
+			return "string"
+		case "integer", "number":
+			return "number"
+		case "boolean":
+			return "boolean"
+		case "null":
+			return "null"
+		case "object":
+			if values, ok := schema["additionalProperties"].(jsonSchema); ok {
+				return fmt.Sprintf("Record<string, %v>", tsType(values))
+			}
+		}
+	}
+	return "unknown"
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// TestSchemaUpToDate fails when the checked in protocol files drift from the
+// Go types, run fgame schema to regenerate them
+func TestSchemaUpToDate(t *testing.T) {
+	schema, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string][]byte{
+		"../../protocol.schema.json":     schema,
+		"../../frontend/src/protocol.ts": TypeScript(),
+	}
+	for path, content := range outputs {
+		current, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(current, content) {
+			t.Errorf("%v is stale, run fgame schema to regenerate it", path)
+		}
+	}
+}
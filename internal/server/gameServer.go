@@ -8,16 +8,20 @@ import (
 
 	"github.com/dchest/uniuri"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/gorilla/websocket"
 )
 
 var signingSecret = uniuri.NewLen(256)
 
+// reconnectGrace is the extra time players get in the current stage after reconnecting
+const reconnectGrace = 5 * time.Second
+
 type GameServer struct {
-	players     map[*websocket.Conn]*Player
-	connections map[string]*websocket.Conn
+	players     map[*Client]*Player
+	connections map[string]*Client
 	rooms       map[string]*GameRoom
 	questions   []string
+	// shadowMuted holds names of players whose chat only they can see, by player id
+	shadowMuted map[string]string
 	mu          sync.Mutex
 }
 
@@ -27,16 +31,13 @@ func (gs *GameServer) InitializeStatusBroadcaster() {
 		<-intervalTicker.C
 		gs.mu.Lock()
 		for _, player := range gs.players {
-			player.connection.WriteJSON(
-				&struct {
-					MsgType     string `json:"msgType"`
-					PlayerCount int    `json:"playerCount"`
-					RoomCount   int    `json:"roomCount"`
-				}{
+			player.connection.send(
+				&StatusMsg{
 					MsgType:     "status",
 					PlayerCount: len(gs.players),
 					RoomCount:   len(gs.rooms),
 				})
+			sendTimeSync(player.connection, 0)
 		}
 		gs.mu.Unlock()
 	}
@@ -76,14 +77,80 @@ func (gs *GameServer) getPlayerById(id string) (*Player, error) {
 	return gs.players[gs.connections[id]], nil
 }
 
-func (gs *GameServer) getPlayerByConnection(c *websocket.Conn) (*Player, error) {
+// findPlayer looks up a registered player by id or name
+func (gs *GameServer) findPlayer(idOrName string) (*Player, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if c, ok := gs.connections[idOrName]; ok && gs.players[c] != nil {
+		return gs.players[c], nil
+	}
+	for _, player := range gs.players {
+		if player.Name == idOrName {
+			return player, nil
+		}
+	}
+	return nil, ErrPlayerNotFound
+}
+
+// shadowMute makes chat messages of the player visible only to themselves
+func (gs *GameServer) shadowMute(idOrName string, muted bool) error {
+	player, err := gs.findPlayer(idOrName)
+	if err != nil {
+		return err
+	}
+	activityLog("admin", 1, "Player", player.Name, "shadow muted:", muted)
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if muted {
+		gs.shadowMuted[player.id] = player.Name
+	} else {
+		delete(gs.shadowMuted, player.id)
+	}
+	return nil
+}
+
+func (gs *GameServer) isShadowMuted(pl *Player) bool {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	_, ok := gs.shadowMuted[pl.id]
+	return ok
+}
+
+// shadowMutedPlayers returns the names of shadow muted players by id
+func (gs *GameServer) shadowMutedPlayers() map[string]string {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	players := make(map[string]string, len(gs.shadowMuted))
+	for id, name := range gs.shadowMuted {
+		players[id] = name
+	}
+	return players
+}
+
+func (gs *GameServer) getPlayerByConnection(c *Client) (*Player, error) {
 	// for _, player := range gs.players {
 	// 	if player.connection == c {
 	// 		return player, nil
 	// 	}
 	// }
 	// return nil, fmt.Errorf("no player with connection %v", c)
-	return gs.players[c], nil
+	player := gs.players[c]
+	if player == nil {
+		return nil, ErrNotRegistered
+	}
+	return player, nil
+}
+
+// getPlayerInRoom returns the player of the connection if they are in a room
+func (gs *GameServer) getPlayerInRoom(c *Client) (*Player, error) {
+	player, err := gs.getPlayerByConnection(c)
+	if err != nil {
+		return nil, err
+	}
+	if player.room == nil {
+		return nil, ErrNotInRoom
+	}
+	return player, nil
 }
 
 func (gs *GameServer) getRoomById(roomId string) (*GameRoom, error) {
@@ -92,30 +159,40 @@ func (gs *GameServer) getRoomById(roomId string) (*GameRoom, error) {
 			return room, nil
 		}
 	}
-	return nil, fmt.Errorf("no room with id %v", roomId)
+	return nil, ErrRoomNotFound
 }
 
 // playerRegister fires on player first connect to the server
-func (gs *GameServer) playerRegister(c *websocket.Conn, name string) {
+func (gs *GameServer) playerRegister(c *Client, name string) error {
+	// names can't be masked, they are rejected regardless of room settings
+	if _, err := filterText(FilterReject, name); err != nil {
+		return err
+	}
+	if bans.check(c.addr, "", name) != nil {
+		return ErrBanned
+	}
 	// lock the mutex
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	// check if player name is unique
 	// O(n) in worst case, not sure how to improve
+	fromAddr := 0
 	for _, player := range gs.players {
 		if player.Name == name {
-			c.WriteJSON(
-				&ErrorMsg{
-					MsgType:   "error",
-					Error:     "Name already taken",
-					ErrorCode: 11,
-				})
-			return
+			return ErrNameTaken
+		}
+		if player.addr() == c.addr {
+			fromAddr++
 		}
 	}
+	if MaxPlayersPerIP > 0 && fromAddr >= MaxPlayersPerIP {
+		activityLog("conn", 1, "Rejected player from", c.addr, "after", fromAddr, "players")
+		countRejection(rejectPlayerCap)
+		return ErrTooManyPlayers
+	}
 	// instantiate player
 	newPlayer := NewPlayer(c, name)
-	activityLog("conn", 3, fmt.Sprintf("PLAYER CONNECT TO SERVER: %+v", newPlayer))
+	activityLog("conn", 3, fmt.Sprintf("PLAYER CONNECT TO SERVER FROM %v: %+v", newPlayer.addr(), newPlayer))
 	// gs.players = append(gs.players, newPlayer)
 	gs.connections[newPlayer.id] = c
 	gs.players[c] = newPlayer
@@ -132,18 +209,16 @@ func (gs *GameServer) playerRegister(c *websocket.Conn, name string) {
 		log.Fatal(err)
 	}
 
-	c.WriteJSON(
-		&struct {
-			MsgType string `json:"msgType"`
-			Data    string `json:"data"`
-		}{
+	c.send(
+		&JwtMsg{
 			MsgType: "jwt",
 			Data:    tokenString,
 		})
+	return nil
 }
 
 // playerLogin fires on player reconnect to the server
-func (gs *GameServer) playerLogin(c *websocket.Conn, tokenString string) {
+func (gs *GameServer) playerLogin(c *Client, tokenString string) error {
 	// lock the mutex
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -159,37 +234,44 @@ func (gs *GameServer) playerLogin(c *websocket.Conn, tokenString string) {
 	})
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if bans.check(c.addr, fmt.Sprint(claims["id"]), fmt.Sprint(claims["name"])) != nil {
+			return ErrBanned
+		}
 		player, err := gs.getPlayerById(fmt.Sprint(claims["id"]))
 		if err == nil {
 			player.mu.Lock()
 			defer player.mu.Unlock()
-			activityLog("conn", 3, "PLAYER REJOIN: ", player)
+			activityLog("conn", 3, "PLAYER REJOIN FROM", c.addr+":", player)
 
-			player.disconnectTimeout.Stop()
+			if player.disconnectTimeout != nil {
+				player.disconnectTimeout.Stop()
+			}
 			gs.players[c] = player
 			delete(gs.players, player.connection)
 			player.connection = c
-			player.sendSelf()
 			if player.room != nil {
-				player.room.sendState() // TODO send state only to the rejoined player
+				// extend first, so the resync already carries the new deadline
+				stage := player.room.GameStage
+				extended := !player.ActionDone && (stage == WritingStage || stage == VotingStage) &&
+					player.room.extendDeadline(player, reconnectGrace)
+				player.room.resyncPlayer(player)
+				if extended {
+					player.room.sendStateExcept(player)
+				}
+			} else {
+				player.sendSelf()
 			}
 			gs.connections[player.id] = c
-			return
+			return nil
 		}
 	}
-	c.WriteJSON(
-		&ErrorMsg{
-			MsgType:   "error",
-			Error:     "Invalid jwt",
-			ErrorCode: 10,
-		})
 	fmt.Println(err)
-
+	return ErrInvalidToken
 }
 
 // playerDisconnect fires on websocket connection disconnect
 // does not mean that the player is leaving the server
-func (gs *GameServer) playerDisconnect(c *websocket.Conn) {
+func (gs *GameServer) playerDisconnect(c *Client) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	for _, player := range gs.players {
@@ -215,17 +297,43 @@ func (gs *GameServer) playerDisconnect(c *websocket.Conn) {
 				delete(gs.connections, player.id)
 				// Delete player in player list
 				delete(gs.players, c)
+				delete(gs.shadowMuted, player.id)
 			}()
 			return
 		}
 	}
 }
 
-func (gs *GameServer) createRoom() *GameRoom {
+// sendTimeSync sends the server clock to the client, clientTime is echoed back
+// so the client can account for latency
+func sendTimeSync(c *Client, clientTime int64) {
+	c.send(
+		&TimeSyncMsg{
+			MsgType:    "timeSync",
+			ClientTime: clientTime,
+			ServerTime: unixMilli(time.Now()),
+		})
+}
+
+// createRoom makes a room unless the address already created MaxRoomsPerIP
+// rooms that are still around
+func (gs *GameServer) createRoom(addr string) (*GameRoom, error) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
+	created := 0
+	for _, room := range gs.rooms {
+		if room.creatorAddr == addr {
+			created++
+		}
+	}
+	if MaxRoomsPerIP > 0 && created >= MaxRoomsPerIP {
+		activityLog("server", 1, "Rejected room from", addr, "after", created, "rooms")
+		countRejection(rejectRoomCap)
+		return nil, ErrTooManyRooms
+	}
 	newRoom := NewGameRoom()
+	newRoom.creatorAddr = addr
 	activityLog("server", 3, "Initializing new room", newRoom.Name)
 	gs.rooms[newRoom.Name] = newRoom
-	return newRoom
+	return newRoom, nil
 }
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RoomSettings holds the rules the host can change before the game starts
+type RoomSettings struct {
+	MaxScore   int        `json:"maxScore"`
+	BallotType BallotType `json:"ballotType"`
+	MaxVotes   int        `json:"maxVotes"`
+	// RevealVoters shows who voted for each answer in the results
+	RevealVoters bool `json:"revealVoters"`
+	// ResultsDuration is how many seconds the round results are shown for
+	ResultsDuration int `json:"resultsDuration"`
+	// HideProgress hides which players have already answered or voted
+	HideProgress bool `json:"hideProgress"`
+	// SlowMode is how many seconds players wait between chat messages, 0 is off
+	SlowMode int `json:"slowMode"`
+	// NoCollusion disables whispers while players answer and vote
+	NoCollusion bool `json:"noCollusion"`
+	// CrowdFavourite is the bonus for the answer with the most reactions, 0 is off
+	CrowdFavourite int `json:"crowdFavourite"`
+	// ContentFilter is what happens to chat messages and answers with filtered words
+	ContentFilter FilterMode `json:"contentFilter"`
+}
+
+func defaultRoomSettings() RoomSettings {
+	return RoomSettings{
+		MaxScore:   MaxScore,
+		BallotType: SingleBallot,
+		MaxVotes:   2,
+
+		ResultsDuration: ResultsDuration,
+		ContentFilter:   FilterMask,
+	}
+}
+
+func (rs RoomSettings) validate() error {
+	if rs.MaxScore < 1 {
+		return fmt.Errorf("max score must be positive, got %v", rs.MaxScore)
+	}
+	if rs.ResultsDuration < 1 || rs.ResultsDuration > 300 {
+		return fmt.Errorf("results duration must be between 1 and 300 seconds, got %v", rs.ResultsDuration)
+	}
+	if rs.SlowMode < 0 || rs.SlowMode > maxSlowMode {
+		return fmt.Errorf("slow mode must be between 0 and %v seconds, got %v", maxSlowMode, rs.SlowMode)
+	}
+	if rs.CrowdFavourite < 0 || rs.CrowdFavourite > 10 {
+		return fmt.Errorf("crowd favourite bonus must be between 0 and 10, got %v", rs.CrowdFavourite)
+	}
+	if !rs.ContentFilter.valid() {
+		return fmt.Errorf("unknown content filter mode %q", rs.ContentFilter)
+	}
+	_, err := newBallot(rs.BallotType, rs.MaxVotes)
+	return err
+}
+
+// merge applies settings encoded as a (possibly partial) json object
+func (rs RoomSettings) merge(data []byte) (RoomSettings, error) {
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return rs, err
+	}
+	return rs, rs.validate()
+}
@@ -4,6 +4,9 @@ import (
 	"bufio"
 	"embed"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
 )
 
 func readLines(path string, f embed.FS) ([]string, error) {
@@ -21,6 +24,23 @@ func readLines(path string, f embed.FS) ([]string, error) {
 	return lines, scanner.Err()
 }
 
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path, so readers never see a partly written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := ioutil.WriteFile(path+".tmp", data, perm); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// unixMilli returns t as milliseconds since epoch, or 0 for zero time
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
 // log message msg with prefix tag, colored according to tagLevel
 // levels from 0 - important, to 4 - verbose
 func activityLog(tag string, tagLevel int, msg ...interface{}) {